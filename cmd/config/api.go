@@ -0,0 +1,143 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// Envelope wraps every JSON response body of the API in a named top-level
+// key, like {"snippet": {...}} or {"error": {...}}.
+type Envelope map[string]any
+
+// APIError is the body of the "error" key in API error responses. Fields is
+// only set for validation failures and maps each invalid field to a message.
+type APIError struct {
+	Status  int               `json:"status"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// maxJSONBodyBytes limits the size of JSON request bodies.
+const maxJSONBodyBytes = 1_048_576
+
+// WriteJSON encodes data as the JSON response body with the given status code.
+func (app *Application) WriteJSON(responseWriter http.ResponseWriter, status int, data Envelope, headers http.Header) error {
+	// encode into memory first, so an encoding error can still become a 500
+	js, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		return err
+	}
+	js = append(js, '\n')
+
+	for key, value := range headers {
+		responseWriter.Header()[key] = value
+	}
+	responseWriter.Header().Set("Content-Type", "application/json")
+	responseWriter.WriteHeader(status)
+	responseWriter.Write(js)
+	return nil
+}
+
+// ReadJSON decodes a JSON request body into destination. The body must hold a
+// single JSON value with no unknown fields. The errors returned describe the
+// problem in a way that's safe to send back to the client.
+func (app *Application) ReadJSON(responseWriter http.ResponseWriter, request *http.Request, destination any) error {
+	request.Body = http.MaxBytesReader(responseWriter, request.Body, maxJSONBodyBytes)
+
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(destination)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown field %s", fieldName)
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		case errors.As(err, &invalidUnmarshalError):
+			// passing a non-nil pointer is a programming error, not a client one
+			panic(err)
+		default:
+			return err
+		}
+	}
+
+	// a second Decode must hit the end of the body, otherwise the client sent
+	// more than one JSON value
+	if err = decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+	return nil
+}
+
+// APIErrorResponse sends a JSON error envelope with the given status code.
+func (app *Application) APIErrorResponse(responseWriter http.ResponseWriter, status int, message string) {
+	apiError := APIError{Status: status, Message: message}
+	err := app.WriteJSON(responseWriter, status, Envelope{"error": apiError}, nil)
+	if err != nil {
+		app.Logger.Error("writing the error response", "error", err)
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// APIServerError is the JSON counterpart of ServerError: it sends a generic 500
+// Internal Server Error envelope (503 Service Unavailable when err is a query
+// running out of time), then logs the error and stack trace.
+func (app *Application) APIServerError(responseWriter http.ResponseWriter, request *http.Request, err error) {
+	status := serverErrorStatus(err)
+	app.APIErrorResponse(responseWriter, status, http.StatusText(status))
+	app.Logger.ErrorContext(request.Context(), err.Error(), "trace", string(debug.Stack()))
+}
+
+// APIClientError is the JSON counterpart of ClientError.
+func (app *Application) APIClientError(responseWriter http.ResponseWriter, status int) {
+	app.APIErrorResponse(responseWriter, status, http.StatusText(status))
+}
+
+// APINotFound is the JSON counterpart of NotFound.
+func (app *Application) APINotFound(responseWriter http.ResponseWriter) {
+	app.APIClientError(responseWriter, http.StatusNotFound)
+}
+
+// APIBadRequest sends a 400 Bad Request envelope describing what's wrong with
+// the request, like an error returned by ReadJSON.
+func (app *Application) APIBadRequest(responseWriter http.ResponseWriter, err error) {
+	app.APIErrorResponse(responseWriter, http.StatusBadRequest, err.Error())
+}
+
+// APIValidationError sends a 422 Unprocessable Entity envelope listing the
+// field errors collected by a validator.Validator.
+func (app *Application) APIValidationError(responseWriter http.ResponseWriter, fieldErrors map[string]string) {
+	apiError := APIError{
+		Status:  http.StatusUnprocessableEntity,
+		Message: "the request contains invalid fields",
+		Fields:  fieldErrors,
+	}
+	err := app.WriteJSON(responseWriter, http.StatusUnprocessableEntity, Envelope{"error": apiError}, nil)
+	if err != nil {
+		app.Logger.Error("writing the error response", "error", err)
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+	}
+}
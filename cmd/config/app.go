@@ -3,17 +3,19 @@ package config
 import (
 	"fcc-project/internal/models"
 	"html/template"
-	"log"
+	"log/slog"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-playground/form/v4"
 )
 
 type Application struct {
-	ErrorLog       *log.Logger
-	InfoLog        *log.Logger
-	Snippets       *models.SnippetModel
+	Logger         *slog.Logger
+	Snippets       models.SnippetStore
+	Users          models.UserStore
+	Tokens         models.TokenStore
 	TemplateCache  map[string]*template.Template
 	FormDecoder    *form.Decoder
 	SessionManager *scs.SessionManager
+	Metrics        *Metrics
 }
@@ -0,0 +1,31 @@
+package config
+
+// contextKey is the type of the keys the application stores in request
+// contexts. Using our own type avoids collisions with keys set by other packages.
+type contextKey string
+
+// AuthenticatedUserContextKey holds the *models.User of the logged in user.
+const AuthenticatedUserContextKey = contextKey("authenticatedUser")
+
+// APITokenContextKey holds the *models.APIToken a request was authenticated with.
+const APITokenContextKey = contextKey("apiToken")
+
+// RequestInfoContextKey holds the *RequestInfo of the request being served.
+const RequestInfoContextKey = contextKey("requestInfo")
+
+// AuthenticatedUserIDSessionKey is the session key holding the ID of the logged in user.
+const AuthenticatedUserIDSessionKey = "authenticatedUserID"
+
+// SnippetKeysSessionKey is the session key holding the management keys of the
+// snippets created or unlocked in the session, as a map[int]string from
+// snippet ID to key.
+const SnippetKeysSessionKey = "snippetKeys"
+
+// CreatedSnippetKeySessionKey holds the management key of a snippet that has
+// just been created, so the view page can show it to its creator once.
+const CreatedSnippetKeySessionKey = "createdSnippetKey"
+
+// UnlockedSnippetsSessionKey is the session key holding the password protected
+// snippets unlocked in the session, as a map[int]time.Time from snippet ID to
+// the time the unlock runs out.
+const UnlockedSnippetsSessionKey = "unlockedSnippets"
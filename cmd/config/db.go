@@ -2,11 +2,16 @@ package config
 
 import (
 	"database/sql"
+
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
 )
 
-func OpenDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
+// OpenDB opens a connection pool using the given database/sql driver name
+// (like "mysql", "pgx" or "sqlite3") and checks that the database is reachable.
+func OpenDB(driverName string, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		return nil, err
 	}
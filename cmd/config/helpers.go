@@ -2,21 +2,42 @@ package config
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fcc-project/internal/models"
 	"fmt"
 	"net/http"
 	"runtime/debug"
 	"time"
 
 	"github.com/go-playground/form/v4"
+	"github.com/justinas/nosurf"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 )
 
-// The ServerError helper writes an error message and stack trace to the errorLog,
-// then sends a generic 500 Internal Server Error response to the user.
-func (app *Application) ServerError(responseWriter http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n%s", err.Error(), debug.Stack())
-	app.ErrorLog.Output(2, trace)
-	http.Error(responseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+// tracer records the spans of the template executions in Render.
+var tracer = otel.Tracer("fcc-project/cmd/config")
+
+// The ServerError helper sends a generic 500 Internal Server Error response to
+// the user (503 Service Unavailable when err is a query running out of time),
+// then logs the error message and stack trace (after the response, so the log
+// line carries its status).
+func (app *Application) ServerError(responseWriter http.ResponseWriter, request *http.Request, err error) {
+	status := serverErrorStatus(err)
+	http.Error(responseWriter, http.StatusText(status), status)
+	app.Logger.ErrorContext(request.Context(), err.Error(), "trace", string(debug.Stack()))
+}
+
+// serverErrorStatus returns the status code of the response to a request
+// which failed with err: 503 Service Unavailable when the database didn't
+// answer in time, since the request may well succeed once it catches up, and
+// 500 Internal Server Error otherwise.
+func serverErrorStatus(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
 }
 
 // The ClientError helper sends a specific status code and corresponding description
@@ -32,14 +53,15 @@ func (app *Application) NotFound(w http.ResponseWriter) {
 	app.ClientError(w, http.StatusNotFound)
 }
 
-func (app *Application) Render(responseWriter http.ResponseWriter, status int, page string, data *TemplateData) {
+func (app *Application) Render(responseWriter http.ResponseWriter, request *http.Request, status int, page string, data *TemplateData) {
 	// retrieve the appropriate template set from the cache map based on the page name
 	// (like 'home.html'). If no entry exists in the cache with the provided name,
 	// then create a new error and call the ServerError() helper method and return
 	ts, ok := app.TemplateCache[page]
 	if !ok {
+		app.Metrics.TemplateFailures.WithLabelValues(page).Inc()
 		err := fmt.Errorf("the template %s does not exist", page)
-		app.ServerError(responseWriter, err)
+		app.ServerError(responseWriter, request, err)
 		return
 	}
 
@@ -54,13 +76,20 @@ func (app *Application) Render(responseWriter http.ResponseWriter, status int, p
 	// http.ResponseWriter. If there's an error, call our serverError() helper
 	// and then return.
 
+	_, span := tracer.Start(request.Context(), "template "+page)
 	err := ts.ExecuteTemplate(templateBuffer, "base", data)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 	// Execute the template set (ts) and write the response body. Again, if there
 	// is any error we call the the serverError() helper.
 	// content of the "base" template will be used/wrriten as response body
 	// which in turn will invoke/contain the other html templates (partials and pages)
 	if err != nil {
-		app.ServerError(responseWriter, err)
+		app.Metrics.TemplateFailures.WithLabelValues(page).Inc()
+		app.ServerError(responseWriter, request, err)
 		return
 	}
 
@@ -76,9 +105,36 @@ func (app *Application) Render(responseWriter http.ResponseWriter, status int, p
 
 func (app *Application) NewTemplateData(request *http.Request) *TemplateData {
 	return &TemplateData{
-		CurrentYear: time.Now().Year(),
-		Flash:       app.SessionManager.PopString(request.Context(), "flash"),
+		CurrentYear:       time.Now().Year(),
+		Flash:             app.SessionManager.PopString(request.Context(), "flash"),
+		AuthenticatedUser: app.AuthenticatedUser(request),
+		CSRFToken:         nosurf.Token(request),
+	}
+}
+
+// AuthenticatedUser returns the logged in user that the authenticate middleware
+// stored in the request context, or nil if the request is from an anonymous visitor.
+func (app *Application) AuthenticatedUser(request *http.Request) *models.User {
+	user, ok := request.Context().Value(AuthenticatedUserContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// IsAuthenticated returns true if the request is from a logged in user.
+func (app *Application) IsAuthenticated(request *http.Request) bool {
+	return app.AuthenticatedUser(request) != nil
+}
+
+// APIToken returns the API token that the authenticateToken middleware stored
+// in the request context, or nil if the request didn't carry one.
+func (app *Application) APIToken(request *http.Request) *models.APIToken {
+	token, ok := request.Context().Value(APITokenContextKey).(*models.APIToken)
+	if !ok {
+		return nil
 	}
+	return token
 }
 
 // Create a new decodePostForm() helper method. The second parameter here destination,
@@ -105,3 +161,50 @@ func (app *Application) DecodePostForm(request *http.Request, destination any) e
 	}
 	return nil
 }
+
+// SnippetKey returns the management key of the given snippet stored in the
+// session, or "" if the session doesn't hold one.
+func (app *Application) SnippetKey(request *http.Request, id int) string {
+	keys, _ := app.SessionManager.Get(request.Context(), SnippetKeysSessionKey).(map[int]string)
+	return keys[id]
+}
+
+// RememberSnippetKey stores the management key of a snippet in the session, so
+// the session can edit and delete the snippet without presenting the key again.
+func (app *Application) RememberSnippetKey(request *http.Request, id int, key string) {
+	keys, _ := app.SessionManager.Get(request.Context(), SnippetKeysSessionKey).(map[int]string)
+	if keys == nil {
+		keys = map[int]string{}
+	}
+	keys[id] = key
+	app.SessionManager.Put(request.Context(), SnippetKeysSessionKey, keys)
+}
+
+// SnippetUnlockTTL is how long giving the password of a snippet unlocks it for
+// the session.
+const SnippetUnlockTTL = 30 * time.Minute
+
+// SnippetUnlocked reports whether the password of the given snippet has been
+// given in the session within the last SnippetUnlockTTL.
+func (app *Application) SnippetUnlocked(request *http.Request, id int) bool {
+	unlocked, _ := app.SessionManager.Get(request.Context(), UnlockedSnippetsSessionKey).(map[int]time.Time)
+	return time.Now().Before(unlocked[id])
+}
+
+// UnlockSnippet records in the session that the password of a snippet has
+// been given, unlocking the snippet for SnippetUnlockTTL.
+func (app *Application) UnlockSnippet(request *http.Request, id int) {
+	unlocked, _ := app.SessionManager.Get(request.Context(), UnlockedSnippetsSessionKey).(map[int]time.Time)
+	if unlocked == nil {
+		unlocked = map[int]time.Time{}
+	}
+	now := time.Now()
+	// drop the unlocks which have run out, so the map doesn't keep growing
+	for snippetID, until := range unlocked {
+		if !now.Before(until) {
+			delete(unlocked, snippetID)
+		}
+	}
+	unlocked[id] = now.Add(SnippetUnlockTTL)
+	app.SessionManager.Put(request.Context(), UnlockedSnippetsSessionKey, unlocked)
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestServerErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"Query past its deadline", fmt.Errorf("models: %w", context.DeadlineExceeded), http.StatusServiceUnavailable},
+		{"Canceled query", context.Canceled, http.StatusInternalServerError},
+		{"Other error", errors.New("boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serverErrorStatus(tt.err); got != tt.want {
+				t.Errorf("got status %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader is the header carrying the ID of a request, both in requests
+// (as set by a proxy in front of the application) and in responses.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestInfo describes the request being served, for its log lines. The
+// requestID middleware adds it to the request context, where the handler of
+// the logger made by NewLogger picks it up.
+type RequestInfo struct {
+	ID     string
+	Method string
+	Path   string
+	Start  time.Time
+	// Status is the status code of the response, 0 until its header is written.
+	Status int
+}
+
+// RequestInfoFromContext returns the RequestInfo of the request ctx belongs
+// to, or nil outside of requests.
+func RequestInfoFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(RequestInfoContextKey).(*RequestInfo)
+	return info
+}
+
+// NewLogger returns a logger writing to w in the given format, "text" or
+// "json". Every line logged with the context of a request carries its ID,
+// method, path, status and latency.
+func NewLogger(w io.Writer, format string) (*slog.Logger, error) {
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(w, nil)
+	case "json":
+		handler = slog.NewJSONHandler(w, nil)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, must be text or json", format)
+	}
+	return slog.New(requestHandler{handler}), nil
+}
+
+// requestHandler adds the attributes of the RequestInfo in the context of a
+// log call to the record, and the ID of the trace it is part of, if any.
+type requestHandler struct {
+	slog.Handler
+}
+
+func (h requestHandler) Handle(ctx context.Context, record slog.Record) error {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		record.AddAttrs(
+			slog.String("request_id", info.ID),
+			slog.String("method", info.Method),
+			slog.String("path", info.Path),
+			slog.Int("status", info.Status),
+			slog.Duration("latency", time.Since(info.Start)),
+		)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		record.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Metrics holds the Prometheus metrics of the application, served on the
+// admin listener.
+type Metrics struct {
+	Registry *prometheus.Registry
+	// Requests counts the requests served by route pattern (like
+	// "GET /s/{slug}") and status class (like "2xx").
+	Requests *prometheus.CounterVec
+	// RequestDuration observes how long serving requests took, by route pattern.
+	RequestDuration *prometheus.HistogramVec
+	// Panics counts the panics caught by the recoverFromPanic middleware.
+	Panics prometheus.Counter
+	// TemplateFailures counts the pages Render failed to render, by page.
+	TemplateFailures *prometheus.CounterVec
+	// SessionStoreErrors counts the errors loading or saving sessions.
+	SessionStoreErrors prometheus.Counter
+}
+
+// NewMetrics returns the metrics of the application, registered on a new
+// registry along with the Go runtime and process metrics and, unless db is
+// nil, the statistics of the connection pool.
+func NewMetrics(db *sql.DB, dbName string) *Metrics {
+	metrics := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_http_requests_total",
+			Help: "HTTP requests served, by route pattern and status class.",
+		}, []string{"route", "status"}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "snippetbox_http_request_duration_seconds",
+			Help:    "Time taken to serve HTTP requests, by route pattern.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route"}),
+		Panics: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snippetbox_http_panics_total",
+			Help: "Panics recovered while serving HTTP requests.",
+		}),
+		TemplateFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "snippetbox_template_render_failures_total",
+			Help: "Pages which failed to render, by page template.",
+		}, []string{"page"}),
+		SessionStoreErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "snippetbox_session_store_errors_total",
+			Help: "Errors loading or saving sessions in the session store.",
+		}),
+	}
+
+	metrics.Registry.MustRegister(
+		metrics.Requests,
+		metrics.RequestDuration,
+		metrics.Panics,
+		metrics.TemplateFailures,
+		metrics.SessionStoreErrors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		metrics.Registry.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+	}
+	return metrics
+}
@@ -1,10 +1,15 @@
 package config
 
 import (
+	"fcc-project/internal/diff"
 	"fcc-project/internal/models"
 	"html/template"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // TemplateData type to act as the holding structure for
@@ -17,17 +22,114 @@ type TemplateData struct {
 	Snippets    []*models.Snippet
 	Form        any
 	Flash       string
+	// Revision is an earlier version of Snippet being viewed, and Revisions
+	// lists all of them.
+	Revision  *models.Revision
+	Revisions []*models.Revision
+	// OtherSnippet is compared with Snippet on the diff page, which shows the
+	// changes as unified Hunks or side-by-side Rows depending on DiffView,
+	// unless DiffTooLarge.
+	OtherSnippet *models.Snippet
+	DiffView     string
+	DiffTooLarge bool
+	Hunks        []diff.Hunk
+	Rows         []diff.Row
+	// ManageKey is the management key of a just created snippet, shown once.
+	ManageKey string
+	// CanManage reports whether the session may edit and delete the snippet.
+	CanManage bool
+	// ShareLink is the link to an unlisted snippet, shown to its owner.
+	ShareLink string
+	// AuthenticatedUser is the logged in user, or nil for anonymous visitors.
+	AuthenticatedUser *models.User
+	// CSRFToken must be posted back as the csrf_token field of every form.
+	CSRFToken string
+	// Sort, NextCursor and PrevCursor drive the paginated snippet listing.
+	Sort       string
+	NextCursor string
+	PrevCursor string
+	// Query and SearchResults hold the search query and its matches.
+	Query         string
+	SearchResults []*models.SearchResult
 }
 
 func HumanDate(date time.Time) string {
 	return date.Format("02 Jan 2006 at 15:04")
 }
 
+// searchPattern returns a case-insensitive regexp matching any word of the
+// search query, or nil when the query has no words.
+func searchPattern(query string) *regexp.Regexp {
+	terms := models.SearchTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	// try longer terms first so they win over terms they contain
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	for i := range terms {
+		terms[i] = regexp.QuoteMeta(terms[i])
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+}
+
+// Highlight HTML-escapes text and wraps every word of the search query found
+// in it in <mark> tags.
+func Highlight(text string, query string) template.HTML {
+	pattern := searchPattern(query)
+	if pattern == nil {
+		return template.HTML(template.HTMLEscapeString(text))
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:match[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(template.HTMLEscapeString(text[match[0]:match[1]]))
+		b.WriteString("</mark>")
+		last = match[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+	return template.HTML(b.String())
+}
+
+// excerptLength is the number of characters of content shown for a search result.
+const excerptLength = 200
+
+// Excerpt returns a slice of text of about excerptLength characters around
+// the first word of the search query found in it.
+func Excerpt(text string, query string) string {
+	runes := []rune(text)
+	if len(runes) <= excerptLength {
+		return text
+	}
+
+	start := 0
+	if pattern := searchPattern(query); pattern != nil {
+		if match := pattern.FindStringIndex(text); match != nil {
+			// convert the byte offset into a rune offset and keep some context
+			start = utf8.RuneCountInString(text[:match[0]]) - excerptLength/4
+		}
+	}
+	start = max(0, min(start, len(runes)-excerptLength))
+
+	excerpt := string(runes[start : start+excerptLength])
+	if start > 0 {
+		excerpt = "…" + excerpt
+	}
+	if start+excerptLength < len(runes) {
+		excerpt += "…"
+	}
+	return excerpt
+}
+
 // Initialize a template.FuncMap object and store it in a global variable. This is
 // essentially a string-keyed map which acts as a lookup between the names of our
 // custom template functions and the functions themselves
 var functions = template.FuncMap{
 	"humanDate": HumanDate,
+	"highlight": Highlight,
+	"excerpt":   Excerpt,
 }
 
 func NewTemplateCache() (map[string]*template.Template, error) {
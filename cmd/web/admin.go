@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fcc-project/cmd/config"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// startAdminServer serves the admin endpoints (see adminRoutes) over plain
+// HTTP on ln in the background, and returns the server so it can be shut
+// down with the main one. The admin address should only be reachable by the
+// operators and their monitoring, never from the internet.
+func startAdminServer(app *config.Application, ln net.Listener) *http.Server {
+	server := &http.Server{
+		Addr:         ln.Addr().String(),
+		ErrorLog:     slog.NewLogLogger(app.Logger.Handler(), slog.LevelError),
+		Handler:      adminRoutes(app),
+		IdleTimeout:  time.Minute,
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	app.Logger.Info("starting admin server", "addr", ln.Addr().String())
+	go func() {
+		if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			app.Logger.Error("admin server", "error", err)
+		}
+	}()
+	return server
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"errors"
+	"fcc-project/cmd/config"
+	"fcc-project/internal/models"
+	"fcc-project/internal/validator"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// The handlers in this file make up version 1 of the JSON API, served under
+// /api/v1/. They mirror the HTML handlers, but read JSON request bodies and
+// answer with JSON envelopes, errors included (see config.APIError).
+
+// manageKeyHeader is the request header carrying the management key of the
+// snippet to update or delete.
+const manageKeyHeader = "X-Manage-Key"
+
+// snippetPasswordHeader is the request header carrying the password of a
+// password protected snippet.
+const snippetPasswordHeader = "X-Snippet-Password"
+
+// API listings return apiDefaultLimit snippets per page unless ?limit= asks for
+// a different number, up to apiMaxLimit.
+const (
+	apiDefaultLimit = 20
+	apiMaxLimit     = 100
+)
+
+// createSnippetInput is the request body of POST /api/v1/snippets. Visibility
+// defaults to public, but burn after reading, password protected and encrypted
+// snippets are never public (see storedVisibility). The content of encrypted
+// snippets must be encrypted like ui/static/js/encrypt.js does, so browsers
+// can decrypt it.
+type createSnippetInput struct {
+	Title               string            `json:"title"`
+	Content             string            `json:"content"`
+	Expires             int               `json:"expires"`
+	Visibility          models.Visibility `json:"visibility"`
+	BurnAfterReading    bool              `json:"burn_after_reading"`
+	Password            string            `json:"password"`
+	Encrypted           bool              `json:"encrypted"`
+	validator.Validator `json:"-"`
+}
+
+// updateSnippetInput is the request body of PUT /api/v1/snippets/{id}.
+type updateSnippetInput struct {
+	Title               string `json:"title"`
+	Content             string `json:"content"`
+	validator.Validator `json:"-"`
+}
+
+// apiSnippetID returns the snippet ID in the path, sending a 404 and returning
+// false if it isn't a valid ID.
+func apiSnippetID(app *config.Application, responseWriter http.ResponseWriter, request *http.Request) (int, bool) {
+	id, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || id < 1 {
+		app.APINotFound(responseWriter)
+		return 0, false
+	}
+	return id, true
+}
+
+// apiSnippetList returns one page of snippets. Like the home page it takes
+// ?sort= and ?cursor=, plus ?limit= for the page size.
+func apiSnippetList(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		query := request.URL.Query()
+
+		sort, ok := models.ParseSnippetSort(query.Get("sort"))
+		if !ok {
+			app.APIBadRequest(responseWriter, errors.New("sort must be newest, oldest or expiring"))
+			return
+		}
+
+		limit := apiDefaultLimit
+		if value := query.Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > apiMaxLimit {
+				app.APIBadRequest(responseWriter, fmt.Errorf("limit must be a number between 1 and %d", apiMaxLimit))
+				return
+			}
+		}
+
+		page, err := app.Snippets.List(request.Context(), sort, query.Get("cursor"), limit)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCursor) {
+				app.APIBadRequest(responseWriter, errors.New("cursor is not valid"))
+			} else {
+				app.APIServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		snippets := page.Snippets
+		if snippets == nil {
+			// an empty page is [] rather than null
+			snippets = []*models.Snippet{}
+		}
+		err = app.WriteJSON(responseWriter, http.StatusOK, config.Envelope{
+			"snippets": snippets,
+			"next":     page.Next,
+			"prev":     page.Prev,
+		}, nil)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+		}
+	}
+}
+
+// apiCanViewSnippet is the API counterpart of canViewSnippet, for snippets
+// addressed by ID. As API clients have no session, private snippets are only
+// returned to requests carrying their management key.
+func apiCanViewSnippet(app *config.Application, request *http.Request, snippet *models.Snippet) (bool, error) {
+	switch snippet.Visibility {
+	case models.VisibilityPublic:
+		return true, nil
+	case models.VisibilityUnlisted:
+		if snippet.ShareTokenMatches(request.URL.Query().Get(shareTokenParam)) {
+			return true, nil
+		}
+	}
+
+	key := request.Header.Get(manageKeyHeader)
+	if key == "" {
+		return false, nil
+	}
+	return app.Snippets.CheckManageKey(request.Context(), snippet.ID, key)
+}
+
+// apiSnippetView returns a single snippet by ID. Unlisted snippets need the
+// ?share= token of an old share link, private ones the management key header.
+func apiSnippetView(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, ok := apiSnippetID(app, responseWriter, request)
+		if !ok {
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.APINotFound(responseWriter)
+			} else {
+				app.APIServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		visible, err := apiCanViewSnippet(app, request, snippet)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+			return
+		}
+		if !visible {
+			app.APINotFound(responseWriter)
+			return
+		}
+		if snippet.Burned() {
+			apiSnippetBurned(app, responseWriter)
+			return
+		}
+
+		err = app.WriteJSON(responseWriter, http.StatusOK, config.Envelope{"snippet": snippet}, nil)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+		}
+	}
+}
+
+// apiSnippetBurned answers requests for the tombstone of a burn after reading
+// snippet with a 410 Gone.
+func apiSnippetBurned(app *config.Application, responseWriter http.ResponseWriter) {
+	app.APIErrorResponse(responseWriter, http.StatusGone, "this snippet burned after reading and has been deleted")
+}
+
+// apiSnippetViewBySlug returns a single snippet by slug. Like the slug link,
+// the slug gives access to public and unlisted snippets; private ones also
+// need the management key header. Without the management key, password
+// protected snippets need their password in the X-Snippet-Password header, and
+// returning a burn after reading snippet burns it: unlike the HTML pages there
+// is no confirmation step, as API clients don't preview links.
+func apiSnippetViewBySlug(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		snippet, err := app.Snippets.GetBySlug(request.Context(), request.PathValue("slug"))
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.APINotFound(responseWriter)
+			} else {
+				app.APIServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		visible := snippet.Visibility != models.VisibilityPrivate
+		owner := false
+		if !visible || snippet.BurnAfterReading || snippet.PasswordProtected() {
+			owner, err = apiCanViewSnippet(app, request, snippet)
+			if err != nil {
+				app.APIServerError(responseWriter, request, err)
+				return
+			}
+			visible = visible || owner
+		}
+		if !visible {
+			app.APINotFound(responseWriter)
+			return
+		}
+		if snippet.Burned() {
+			apiSnippetBurned(app, responseWriter)
+			return
+		}
+		if snippet.PasswordProtected() && !owner {
+			password := request.Header.Get(snippetPasswordHeader)
+			if password == "" {
+				app.APIErrorResponse(responseWriter, http.StatusForbidden, "this snippet is password protected: the "+snippetPasswordHeader+" header must hold its password")
+				return
+			}
+			if !snippet.PasswordMatches(password) {
+				app.APIErrorResponse(responseWriter, http.StatusForbidden, "that is not the password of this snippet")
+				return
+			}
+		}
+
+		if snippet.BurnAfterReading && !owner {
+			snippet, err = app.Snippets.Burn(request.Context(), snippet.Slug)
+			if err != nil {
+				// someone else read it in the meantime
+				if errors.Is(err, models.ErrNoRecord) {
+					apiSnippetBurned(app, responseWriter)
+				} else {
+					app.APIServerError(responseWriter, request, err)
+				}
+				return
+			}
+			responseWriter.Header().Set("Cache-Control", "no-store")
+		}
+
+		err = app.WriteJSON(responseWriter, http.StatusOK, config.Envelope{"snippet": snippet}, nil)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+		}
+	}
+}
+
+// apiSnippetCreate creates a snippet. The response holds the new snippet and
+// its management key, which is never shown again.
+func apiSnippetCreate(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		var input createSnippetInput
+		err := app.ReadJSON(responseWriter, request, &input)
+		if err != nil {
+			app.APIBadRequest(responseWriter, err)
+			return
+		}
+
+		input.Validator.CheckField(validator.NotBlank(input.Title), "title", "This field cannot be blank")
+		input.Validator.CheckField(validator.MaxChars(input.Title, 100), "title", "This field cannnot be more than 100 characters long")
+		input.Validator.CheckField(validator.NotBlank(input.Content), "content", "This field cannot be blank")
+		input.Validator.CheckField(len(input.Content) <= models.MaxContentBytes, "content", "This field cannot be more than 48000 bytes long")
+		input.Validator.CheckField(validator.PermittedInt(input.Expires, 1, 7, 365), "expires", "This field must equal 1, 7 or 365")
+		if input.Visibility == "" {
+			input.Visibility = models.VisibilityPublic
+		}
+		input.Validator.CheckField(
+			validator.PermittedValue(input.Visibility, models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate),
+			"visibility",
+			"This field must be public, unlisted or private",
+		)
+		input.Validator.CheckField(len(input.Password) <= maxPasswordBytes, "password", "This field cannot be more than 72 bytes long")
+		if input.Encrypted {
+			input.Validator.CheckField(validCiphertext(input.Content), "content", "This field must hold the content encrypted with AES-GCM, base64 encoded")
+		}
+
+		if !input.Valid() {
+			app.APIValidationError(responseWriter, input.FieldErrors)
+			return
+		}
+
+		id, key, err := app.Snippets.Insert(
+			request.Context(),
+			input.Title,
+			input.Content,
+			input.Expires,
+			storedVisibility(input.Visibility, input.BurnAfterReading, input.Password, input.Encrypted),
+			input.BurnAfterReading,
+			input.Password,
+			input.Encrypted,
+		)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+			return
+		}
+
+		headers := make(http.Header)
+		headers.Set("Location", fmt.Sprintf("/api/v1/snippets/%d", id))
+		envelope := config.Envelope{
+			"snippet":    snippet,
+			"manage_key": key,
+		}
+		if snippet.Visibility == models.VisibilityUnlisted {
+			envelope["share_link"] = snippetPath(snippet)
+		}
+		err = app.WriteJSON(responseWriter, http.StatusCreated, envelope, headers)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+		}
+	}
+}
+
+// apiCheckManageKey reports whether the request carries the management key of
+// the snippet, sending the error response and returning false if it doesn't.
+// Snippets which aren't public are reported as missing instead, so their IDs
+// can't be probed.
+func apiCheckManageKey(app *config.Application, responseWriter http.ResponseWriter, request *http.Request, snippet *models.Snippet) bool {
+	key := request.Header.Get(manageKeyHeader)
+	ok := false
+	if key != "" {
+		var err error
+		ok, err = app.Snippets.CheckManageKey(request.Context(), snippet.ID, key)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+			return false
+		}
+	}
+
+	switch {
+	case ok:
+		return true
+	case snippet.Visibility != models.VisibilityPublic:
+		app.APINotFound(responseWriter)
+	case key == "":
+		app.APIErrorResponse(responseWriter, http.StatusForbidden, "the "+manageKeyHeader+" header must hold the management key of the snippet")
+	default:
+		app.APIErrorResponse(responseWriter, http.StatusForbidden, "that is not the management key of this snippet")
+	}
+	return false
+}
+
+// apiSnippetUpdate replaces the title and content of a snippet, keeping the
+// previous version as a revision.
+func apiSnippetUpdate(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, ok := apiSnippetID(app, responseWriter, request)
+		if !ok {
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.APINotFound(responseWriter)
+			} else {
+				app.APIServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		if !apiCheckManageKey(app, responseWriter, request, snippet) {
+			return
+		}
+
+		var input updateSnippetInput
+		err = app.ReadJSON(responseWriter, request, &input)
+		if err != nil {
+			app.APIBadRequest(responseWriter, err)
+			return
+		}
+
+		input.Validator.CheckField(validator.NotBlank(input.Title), "title", "This field cannot be blank")
+		input.Validator.CheckField(validator.MaxChars(input.Title, 100), "title", "This field cannnot be more than 100 characters long")
+		input.Validator.CheckField(validator.NotBlank(input.Content), "content", "This field cannot be blank")
+		input.Validator.CheckField(len(input.Content) <= models.MaxContentBytes, "content", "This field cannot be more than 48000 bytes long")
+		if snippet.Encrypted {
+			input.Validator.CheckField(validCiphertext(input.Content), "content", "This field must hold the content encrypted with AES-GCM, base64 encoded")
+		}
+
+		if !input.Valid() {
+			app.APIValidationError(responseWriter, input.FieldErrors)
+			return
+		}
+
+		err = app.Snippets.Update(request.Context(), id, input.Title, input.Content)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.APINotFound(responseWriter)
+			} else {
+				app.APIServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		snippet, err = app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+			return
+		}
+
+		err = app.WriteJSON(responseWriter, http.StatusOK, config.Envelope{"snippet": snippet}, nil)
+		if err != nil {
+			app.APIServerError(responseWriter, request, err)
+		}
+	}
+}
+
+// apiSnippetDelete deletes a snippet.
+func apiSnippetDelete(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, ok := apiSnippetID(app, responseWriter, request)
+		if !ok {
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.APINotFound(responseWriter)
+			} else {
+				app.APIServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		if !apiCheckManageKey(app, responseWriter, request, snippet) {
+			return
+		}
+
+		err = app.Snippets.Delete(request.Context(), id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.APIServerError(responseWriter, request, err)
+			return
+		}
+
+		responseWriter.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// apiNotFound answers requests for unknown API paths, so they get a JSON error
+// like everything else under /api/.
+func apiNotFound(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		app.APINotFound(responseWriter)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fcc-project/internal/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// apiRequest returns a request to the API of ts, authenticated with token
+// unless it is empty.
+func (ts *testServer) apiRequest(t *testing.T, method string, urlPath string, token string, body string) *http.Request {
+	t.Helper()
+
+	request, err := http.NewRequest(method, ts.URL+urlPath, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return request
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, routes(app))
+
+	snippet := insertSnippet(t, app.Snippets, "An old silent pond", "An old silent pond...", models.VisibilityPublic)
+	managedID, manageKey, err := app.Snippets.Insert(context.Background(), "A frog jumps", "A frog jumps into the pond", 7, models.VisibilityPublic, false, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, readToken, err := app.Tokens.Insert(context.Background(), "reader", models.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, writeToken, err := app.Tokens.Insert(context.Background(), "writer", models.ScopeWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const newSnippet = `{"title": "A title", "content": "Some content", "expires": 7}`
+	const update = `{"title": "A new title", "content": "Some new content"}`
+	managedPath := "/api/v1/snippets/" + strconv.Itoa(managedID)
+
+	tests := []struct {
+		name      string
+		method    string
+		urlPath   string
+		token     string
+		manageKey string
+		body      string
+		wantCode  int
+	}{
+		{"List without a token", http.MethodGet, "/api/v1/snippets", "", "", "", http.StatusUnauthorized},
+		{"List with an unknown token", http.MethodGet, "/api/v1/snippets", "snip_nope", "", "", http.StatusUnauthorized},
+		{"List with a read token", http.MethodGet, "/api/v1/snippets", readToken, "", "", http.StatusOK},
+		{"List with a write token", http.MethodGet, "/api/v1/snippets", writeToken, "", "", http.StatusOK},
+		{"View without a token", http.MethodGet, "/api/v1/snippets/" + strconv.Itoa(snippet.ID), "", "", "", http.StatusUnauthorized},
+		{"View with a read token", http.MethodGet, "/api/v1/snippets/" + strconv.Itoa(snippet.ID), readToken, "", "", http.StatusOK},
+		{"View by slug with a read token", http.MethodGet, "/api/v1/snippets/slug/" + snippet.Slug, readToken, "", "", http.StatusOK},
+		{"Create without a token", http.MethodPost, "/api/v1/snippets", "", "", newSnippet, http.StatusUnauthorized},
+		{"Create with a read token", http.MethodPost, "/api/v1/snippets", readToken, "", newSnippet, http.StatusForbidden},
+		{"Create with a write token", http.MethodPost, "/api/v1/snippets", writeToken, "", newSnippet, http.StatusCreated},
+		{"Update without a token", http.MethodPut, managedPath, "", manageKey, update, http.StatusUnauthorized},
+		{"Update with a read token", http.MethodPut, managedPath, readToken, manageKey, update, http.StatusForbidden},
+		{"Update with a write token but no key", http.MethodPut, managedPath, writeToken, "", update, http.StatusForbidden},
+		{"Update with a write token", http.MethodPut, managedPath, writeToken, manageKey, update, http.StatusOK},
+		{"Delete without a token", http.MethodDelete, managedPath, "", manageKey, "", http.StatusUnauthorized},
+		{"Delete with a read token", http.MethodDelete, managedPath, readToken, manageKey, "", http.StatusForbidden},
+		{"Delete with a write token but no key", http.MethodDelete, managedPath, writeToken, "", "", http.StatusForbidden},
+		{"Delete with a write token", http.MethodDelete, managedPath, writeToken, manageKey, "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := ts.apiRequest(t, tt.method, tt.urlPath, tt.token, tt.body)
+			if tt.manageKey != "" {
+				request.Header.Set(manageKeyHeader, tt.manageKey)
+			}
+			status, _, body := ts.do(t, request)
+			if status != tt.wantCode {
+				t.Errorf("got status %d; want %d:\n%s", status, tt.wantCode, body)
+			}
+		})
+	}
+}
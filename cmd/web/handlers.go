@@ -1,13 +1,15 @@
 package main
 
 import (
+	"encoding/base64"
 	"errors"
 	"fcc-project/cmd/config"
+	"fcc-project/internal/diff"
 	"fcc-project/internal/models"
 	"fcc-project/internal/validator"
-	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 // Define a createSnippetFormData struct to represent the form data and validation
@@ -22,54 +24,497 @@ import (
 // input with the name "title" in the Title field. The struct tag `form:"-"`
 // tells the decoder to completely ignore a field during decoding.
 type createSnippetFormData struct {
-	Title               string `form:"title"`
-	Content             string `form:"content"`
-	Expires             int    `form:"expires"`
+	Title               string            `form:"title"`
+	Content             string            `form:"content"`
+	Expires             int               `form:"expires"`
+	Visibility          models.Visibility `form:"visibility"`
+	BurnAfterReading    bool              `form:"burn_after_reading"`
+	Password            string            `form:"password"`
+	Encrypted           bool              `form:"encrypted"`
+	validator.Validator `form:"-"`
+}
+
+// unlockSnippetFormData represents the form asking for the password of a
+// password protected snippet.
+type unlockSnippetFormData struct {
+	Password            string `form:"password"`
 	validator.Validator `form:"-"`
 }
 
+// maxPasswordBytes is the length limit of the passwords of users and
+// snippets: bcrypt refuses to hash longer passwords.
+const maxPasswordBytes = 72
+
+// The content of encrypted snippets is the base64 encoding of the AES-GCM
+// nonce followed by the ciphertext and authentication tag, as produced by
+// ui/static/js/encrypt.js.
+const (
+	ciphertextNonceBytes = 12
+	ciphertextTagBytes   = 16
+)
+
+// validCiphertext reports whether content has the format of the content of
+// encrypted snippets. Only the format can be checked, as the server doesn't
+// have the key.
+func validCiphertext(content string) bool {
+	ciphertext, err := base64.StdEncoding.DecodeString(content)
+	return err == nil && len(ciphertext) > ciphertextNonceBytes+ciphertextTagBytes
+}
+
+// snippetsPerPage is the number of snippets shown on each page of the listing.
+const snippetsPerPage = 10
+
+// home renders one page of the snippet listing. It serves both the home page
+// and GET /snippets, where the optional ?sort= and ?cursor= query parameters
+// pick the order and the page.
 func home(app *config.Application) http.HandlerFunc {
 	return func(responseWriter http.ResponseWriter, request *http.Request) {
-		snippets, err := app.Snippets.Latest()
+		sort, ok := models.ParseSnippetSort(request.URL.Query().Get("sort"))
+		if !ok {
+			app.ClientError(responseWriter, http.StatusBadRequest)
+			return
+		}
+
+		page, err := app.Snippets.List(request.Context(), sort, request.URL.Query().Get("cursor"), snippetsPerPage)
 		if err != nil {
-			app.ServerError(responseWriter, err)
+			if errors.Is(err, models.ErrInvalidCursor) {
+				app.ClientError(responseWriter, http.StatusBadRequest)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
 			return
 		}
 
 		// Create an instance of a TemplateData struct holding the data.
 		data := app.NewTemplateData(request)
-		data.Snippets = snippets
-		app.Render(responseWriter, http.StatusOK, "home.html", data)
+		data.Snippets = page.Snippets
+		data.Sort = string(sort)
+		data.NextCursor = page.Next
+		data.PrevCursor = page.Prev
+		app.Render(responseWriter, request, http.StatusOK, "home.html", data)
+	}
+}
+
+// searchResultsLimit is the maximum number of matches shown for a search.
+const searchResultsLimit = 25
+
+// snippetSearch renders the snippets matching the ?q= query parameter, best
+// match first.
+func snippetSearch(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		query := strings.TrimSpace(request.URL.Query().Get("q"))
+
+		results, err := app.Snippets.Search(request.Context(), query, searchResultsLimit)
+		if err != nil {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
+
+		data := app.NewTemplateData(request)
+		data.Query = query
+		data.SearchResults = results
+		app.Render(responseWriter, request, http.StatusOK, "search.html", data)
 	}
 }
 
+// snippetView shows a snippet, looked up by the slug in its link. Anyone with
+// the link may view public and unlisted snippets, private ones only their owner.
 func snippetView(app *config.Application) http.HandlerFunc {
 	return func(responseWriter http.ResponseWriter, request *http.Request) {
 
+		// Use the SnippetModel object's GetBySlug method to retrieve the data
+		// for a specific record based on its slug. If no matching record is
+		// found, return a 404 Not Found response.
+		snippet, err := app.Snippets.GetBySlug(request.Context(), request.PathValue("slug"))
+
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+		id := snippet.ID
+		if snippet.Visibility == models.VisibilityPrivate && app.SnippetKey(request, id) == "" {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		data := app.NewTemplateData(request)
+		if snippet.Burned() {
+			app.Render(responseWriter, request, http.StatusGone, "burned.html", data)
+			return
+		}
+
+		data.Snippet = snippet
+		// the management key is only ever shown once, right after creation
+		data.ManageKey = app.SessionManager.PopString(request.Context(), config.CreatedSnippetKeySessionKey)
+		data.CanManage = app.SnippetKey(request, id) != ""
+
+		if snippetLocked(app, request, snippet) {
+			data.Form = unlockSnippetFormData{}
+			app.Render(responseWriter, request, http.StatusOK, "unlock.html", data)
+			return
+		}
+
+		// Reading a burn after reading snippet takes a POST from the page
+		// asking for confirmation, so the link previews of chat apps and the
+		// like (which only GET the link) don't burn it. Its owner may look at
+		// it without burning it.
+		if snippet.BurnAfterReading && !data.CanManage {
+			responseWriter.Header().Set("Cache-Control", "no-store")
+			app.Render(responseWriter, request, http.StatusOK, "burn.html", data)
+			return
+		}
+		// the owner of an unlisted snippet is reminded that its link is the
+		// only way to find it
+		if snippet.Visibility == models.VisibilityUnlisted && data.CanManage {
+			data.ShareLink = snippetPath(snippet)
+		}
+
+		// ?revision= shows an earlier version of the snippet, which can be restored
+		if value := request.URL.Query().Get("revision"); value != "" {
+			revisionID, err := strconv.Atoi(value)
+			if err != nil || revisionID < 1 {
+				app.NotFound(responseWriter)
+				return
+			}
+
+			revision, err := app.Snippets.GetRevision(request.Context(), id, revisionID)
+			if err != nil {
+				if errors.Is(err, models.ErrNoRecord) {
+					app.NotFound(responseWriter)
+				} else {
+					app.ServerError(responseWriter, request, err)
+				}
+				return
+			}
+			data.Revision = revision
+			data.Form = editSnippetFormData{}
+		}
+
+		app.Render(responseWriter, request, http.StatusOK, "view.html", data)
+	}
+}
+
+// snippetLocked reports whether a snippet is password protected and the
+// session hasn't unlocked it. The owner of a snippet needs no password.
+func snippetLocked(app *config.Application, request *http.Request, snippet *models.Snippet) bool {
+	return snippet.PasswordProtected() &&
+		app.SnippetKey(request, snippet.ID) == "" &&
+		!app.SnippetUnlocked(request, snippet.ID)
+}
+
+// snippetUnlockPost checks the password posted for a password protected
+// snippet. The right password unlocks the snippet for the session (for
+// config.SnippetUnlockTTL), and the request is redirected to the snippet.
+func snippetUnlockPost(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		snippet, err := app.Snippets.GetBySlug(request.Context(), request.PathValue("slug"))
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+		if snippet.Visibility == models.VisibilityPrivate && app.SnippetKey(request, snippet.ID) == "" {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		var form unlockSnippetFormData
+		err = app.DecodePostForm(request, &form)
+		if err != nil {
+			app.ClientError(responseWriter, http.StatusBadRequest)
+			return
+		}
+
+		if !snippet.PasswordMatches(form.Password) {
+			form.AddFieldError("password", "This is not the password of this snippet")
+
+			data := app.NewTemplateData(request)
+			data.Snippet = snippet
+			data.Form = unlockSnippetFormData{Validator: form.Validator}
+			app.Render(responseWriter, request, http.StatusUnprocessableEntity, "unlock.html", data)
+			return
+		}
+
+		app.UnlockSnippet(request, snippet.ID)
+		http.Redirect(responseWriter, request, snippetPath(snippet), http.StatusSeeOther)
+	}
+}
+
+// snippetBurnPost shows a burn after reading snippet for the first and last
+// time: it is wiped as it is read. When someone else read it first, or the
+// snippet is password protected and still locked, the request is redirected
+// to the snippet link, which tells what's up.
+func snippetBurnPost(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		snippet, err := app.Snippets.GetBySlug(request.Context(), request.PathValue("slug"))
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+		if snippet.Visibility == models.VisibilityPrivate && app.SnippetKey(request, snippet.ID) == "" {
+			app.NotFound(responseWriter)
+			return
+		}
+		if snippetLocked(app, request, snippet) {
+			http.Redirect(responseWriter, request, snippetPath(snippet), http.StatusSeeOther)
+			return
+		}
+
+		burned, err := app.Snippets.Burn(request.Context(), snippet.Slug)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				http.Redirect(responseWriter, request, snippetPath(snippet), http.StatusSeeOther)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		data := app.NewTemplateData(request)
+		data.Snippet = burned
+		// the snippet is gone, so this page must not be kept anywhere either
+		responseWriter.Header().Set("Cache-Control", "no-store")
+		app.Render(responseWriter, request, http.StatusOK, "view.html", data)
+	}
+}
+
+// snippetViewByID redirects the /snippet/view/{id} links from before slugs to
+// the slug link of the snippet, keeping the rest of the query (like
+// ?revision=). Snippets which can't be seen by ID keep answering 404.
+func snippetViewByID(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
 		id, err := strconv.Atoi(request.PathValue("id"))
 		if err != nil || id < 1 {
 			app.NotFound(responseWriter)
 			return
 		}
 
-		// Use the SnippetModel object's Get method to retrieve the data for a
-		// specific record based on its ID. If no matching record is found,
-		// return a 404 Not Found response.
-		snippet, err := app.Snippets.Get(id)
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+		if !canViewSnippet(app, request, snippet) {
+			app.NotFound(responseWriter)
+			return
+		}
 
+		target := snippetPath(snippet)
+		query := request.URL.Query()
+		query.Del(shareTokenParam)
+		if encoded := query.Encode(); encoded != "" {
+			target += "?" + encoded
+		}
+		http.Redirect(responseWriter, request, target, http.StatusMovedPermanently)
+	}
+}
+
+// snippetHistory lists the earlier versions of a snippet.
+func snippetHistory(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, err := strconv.Atoi(request.PathValue("id"))
+		if err != nil || id < 1 {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
 		if err != nil {
 			if errors.Is(err, models.ErrNoRecord) {
 				app.NotFound(responseWriter)
 			} else {
-				app.ServerError(responseWriter, err)
+				app.ServerError(responseWriter, request, err)
 			}
 			return
 		}
+		if !canViewSnippet(app, request, snippet) {
+			app.NotFound(responseWriter)
+			return
+		}
+		// the snippet link asks for the password, or for confirmation before
+		// burning, first
+		if !canReadSnippet(app, request, snippet) {
+			http.Redirect(responseWriter, request, snippetPath(snippet), http.StatusSeeOther)
+			return
+		}
+
+		revisions, err := app.Snippets.Revisions(request.Context(), id)
+		if err != nil {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
 
 		data := app.NewTemplateData(request)
 		data.Snippet = snippet
+		data.Revisions = revisions
+		app.Render(responseWriter, request, http.StatusOK, "history.html", data)
+	}
+}
+
+// diffContext is the number of unchanged lines shown around each change in
+// the unified view.
+const diffContext = 3
+
+// diffMaxLines is the number of lines of the snippets past which they aren't
+// compared: diffing unrelated texts takes time quadratic in their length.
+const diffMaxLines = 5000
+
+// snippetDiff compares two snippets, ?a= (the old one) and ?b= (the new one),
+// line by line. ?view=split shows them side by side, otherwise a unified diff
+// is shown. Without both ids only the form picking the snippets is shown.
+func snippetDiff(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		query := request.URL.Query()
+
+		view := query.Get("view")
+		if view != "split" {
+			view = "unified"
+		}
+
+		data := app.NewTemplateData(request)
+		data.DiffView = view
+
+		// load whichever snippets were asked for, so the form can be re-populated
+		var snippets [2]*models.Snippet
+		for i, param := range []string{"a", "b"} {
+			value := query.Get(param)
+			if value == "" {
+				continue
+			}
+			id, err := strconv.Atoi(value)
+			if err != nil || id < 1 {
+				app.NotFound(responseWriter)
+				return
+			}
+			snippets[i], err = app.Snippets.Get(request.Context(), id)
+			if err != nil {
+				if errors.Is(err, models.ErrNoRecord) {
+					app.NotFound(responseWriter)
+				} else {
+					app.ServerError(responseWriter, request, err)
+				}
+				return
+			}
+			if !canViewSnippet(app, request, snippets[i]) || !canReadSnippet(app, request, snippets[i]) {
+				app.NotFound(responseWriter)
+				return
+			}
+			// ciphertext can't be compared in any meaningful way
+			if snippets[i].Encrypted {
+				app.ClientError(responseWriter, http.StatusBadRequest)
+				return
+			}
+		}
+		data.Snippet, data.OtherSnippet = snippets[0], snippets[1]
+
+		if data.Snippet != nil && data.OtherSnippet != nil {
+			if lineCount(data.Snippet.Content) > diffMaxLines || lineCount(data.OtherSnippet.Content) > diffMaxLines {
+				data.DiffTooLarge = true
+			} else if lines := diff.Lines(data.Snippet.Content, data.OtherSnippet.Content); view == "split" {
+				data.Rows = diff.SideBySide(lines)
+			} else {
+				data.Hunks = diff.Unified(lines, diffContext)
+			}
+		}
+
+		app.Render(responseWriter, request, http.StatusOK, "diff.html", data)
+	}
+}
+
+// lineCount returns the number of lines of text.
+func lineCount(text string) int {
+	return strings.Count(text, "\n") + 1
+}
+
+// snippetRestorePost makes an earlier revision the current version of a
+// snippet. Like editing, it needs the management key of the snippet; the
+// version being replaced becomes a revision itself, so restoring can be undone.
+func snippetRestorePost(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, err := strconv.Atoi(request.PathValue("id"))
+		if err != nil || id < 1 {
+			app.NotFound(responseWriter)
+			return
+		}
+		revisionID, err := strconv.Atoi(request.PathValue("revision"))
+		if err != nil || revisionID < 1 {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+		revision, err := app.Snippets.GetRevision(request.Context(), id, revisionID)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		var form editSnippetFormData
+		err = app.DecodePostForm(request, &form)
+		if err != nil {
+			app.ClientError(responseWriter, http.StatusBadRequest)
+			return
+		}
+
+		allowed, err := canManageSnippet(app, request, id, form.Key)
+		if err != nil {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
+		if !allowed && !canViewSnippet(app, request, snippet) {
+			app.NotFound(responseWriter)
+			return
+		}
+		if !allowed {
+			form.AddFieldError("key", "This is not the management key of this snippet")
+
+			data := app.NewTemplateData(request)
+			data.Snippet = snippet
+			data.Revision = revision
+			data.Form = form
+			app.Render(responseWriter, request, http.StatusUnprocessableEntity, "view.html", data)
+			return
+		}
+
+		err = app.Snippets.Update(request.Context(), id, revision.Title, revision.Content)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
 
-		app.Render(responseWriter, http.StatusOK, "view.html", data)
+		app.SessionManager.Put(request.Context(), "flash", "Snippet successfully restored!")
+		http.Redirect(responseWriter, request, snippetPath(snippet), http.StatusSeeOther)
 	}
 }
 
@@ -80,9 +525,10 @@ func snippetCreateForm(app *config.Application) http.HandlerFunc {
 		// Notice how this is also a great opportunity to set any default or
 		// 'initial' values for the form --- here we set the initial value forthe snippet expiry to 365 days.
 		data.Form = createSnippetFormData{
-			Expires: 365,
+			Expires:    365,
+			Visibility: models.VisibilityPublic,
 		}
-		app.Render(responseWriter, http.StatusOK, "create.html", data)
+		app.Render(responseWriter, request, http.StatusOK, "create.html", data)
 	}
 }
 
@@ -117,29 +563,542 @@ func snippetCreatePost(app *config.Application) http.HandlerFunc {
 			"content",
 			"This field cannot be blank",
 		)
+		form.Validator.CheckField(
+			len(form.Content) <= models.MaxContentBytes,
+			"content",
+			"This field cannot be more than 48000 bytes long",
+		)
 		form.Validator.CheckField(
 			validator.PermittedInt(form.Expires, 1, 7, 365),
 			"expires",
 			"This field must equal 1, 7 or 365",
 		)
+		form.Validator.CheckField(
+			validator.PermittedValue(form.Visibility, models.VisibilityPublic, models.VisibilityUnlisted, models.VisibilityPrivate),
+			"visibility",
+			"This field must be public, unlisted or private",
+		)
+		form.Validator.CheckField(
+			len(form.Password) <= maxPasswordBytes,
+			"password",
+			"This field cannot be more than 72 bytes long",
+		)
+		if form.Encrypted {
+			form.Validator.CheckField(
+				validCiphertext(form.Content),
+				"content",
+				"This field must hold the content as encrypted by the browser",
+			)
+		}
 
 		// If there are any validation errors re-display the create.html template,
 		// passing in the snippetCreateForm instance as dynamic data in the Form
 		// field. Note that we use the HTTP status code 422 Unprocessable Entity
 		// when sending the response to indicate that there was a validation error.
 		if !form.Valid() {
+			// the browser replaced the content of an encrypted snippet with
+			// ciphertext, which mustn't be encrypted a second time
+			if form.Encrypted {
+				form.Content = ""
+				form.AddFieldError("content", "The content was encrypted before sending, so it must be entered again")
+			}
 			data := app.NewTemplateData(request)
 			data.Form = form
-			app.Render(responseWriter, http.StatusUnprocessableEntity, "create.html", data)
+			app.Render(responseWriter, request, http.StatusUnprocessableEntity, "create.html", data)
 			return
 		}
 
-		id, err := app.Snippets.Insert(form.Title, form.Content, form.Expires)
+		id, key, err := app.Snippets.Insert(
+			request.Context(),
+			form.Title,
+			form.Content,
+			form.Expires,
+			storedVisibility(form.Visibility, form.BurnAfterReading, form.Password, form.Encrypted),
+			form.BurnAfterReading,
+			form.Password,
+			form.Encrypted,
+		)
 		if err != nil {
-			app.ServerError(responseWriter, err)
+			app.ServerError(responseWriter, request, err)
 			return
 		}
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
+		// keep the management key in the session, so this browser can manage
+		// the snippet, and hand it to the creator once on the view page
+		app.RememberSnippetKey(request, id, key)
+		app.SessionManager.Put(request.Context(), config.CreatedSnippetKeySessionKey, key)
 		app.SessionManager.Put(request.Context(), "flash", "Snippert successfully created!")
-		http.Redirect(responseWriter, request, fmt.Sprintf("/snippet/view/%d", id), http.StatusSeeOther)
+		http.Redirect(responseWriter, request, snippetPath(snippet), http.StatusSeeOther)
+	}
+}
+
+// storedVisibility returns the visibility a new snippet is stored with. Burn
+// after reading, password protected and encrypted snippets are never listed:
+// the first reader of the former could be anyone browsing the listing, which
+// would also show the content of the password protected ones, and the
+// encrypted ones can't be read without the key in their link anyway. So
+// public ones become unlisted.
+func storedVisibility(visibility models.Visibility, burnAfterReading bool, password string, encrypted bool) models.Visibility {
+	if (burnAfterReading || password != "" || encrypted) && visibility == models.VisibilityPublic {
+		return models.VisibilityUnlisted
+	}
+	return visibility
+}
+
+// editSnippetFormData represents the edit and delete forms of a snippet. Key is
+// the management key, which is only asked for when the session doesn't hold it.
+type editSnippetFormData struct {
+	Title               string `form:"title"`
+	Content             string `form:"content"`
+	Key                 string `form:"key"`
+	validator.Validator `form:"-"`
+}
+
+// manageSnippetFormData represents the form presenting the management key of
+// a snippet, and its validation errors.
+type manageSnippetFormData struct {
+	Key                 string `form:"key"`
+	validator.Validator `form:"-"`
+}
+
+// canManageSnippet reports whether the request may edit or delete a snippet,
+// either because the session holds its management key or because the given
+// key is presented. A valid presented key is remembered in the session.
+func canManageSnippet(app *config.Application, request *http.Request, id int, key string) (bool, error) {
+	presented := key != ""
+	if !presented {
+		key = app.SnippetKey(request, id)
+	}
+	if key == "" {
+		return false, nil
+	}
+
+	ok, err := app.Snippets.CheckManageKey(request.Context(), id, key)
+	if err != nil || !ok {
+		return false, err
+	}
+	if presented {
+		app.RememberSnippetKey(request, id, key)
+	}
+	return true, nil
+}
+
+// shareTokenParam is the query parameter holding the share token in the
+// /snippet/view/{id}?share= links to unlisted snippets from before slugs.
+const shareTokenParam = "share"
+
+// snippetPath returns the link to a snippet's page. As it holds the slug, it
+// is also the link through which an unlisted snippet is shared.
+func snippetPath(snippet *models.Snippet) string {
+	return "/s/" + snippet.Slug
+}
+
+// canViewSnippet reports whether the request may see a snippet on the pages
+// addressing it by ID. Anyone may see public snippets, and unlisted ones
+// through an old share link. Other snippets are only visible to their owner:
+// the session which created the snippet, or one its management key has been
+// presented in since.
+func canViewSnippet(app *config.Application, request *http.Request, snippet *models.Snippet) bool {
+	if snippet.Visibility == models.VisibilityPublic || app.SnippetKey(request, snippet.ID) != "" {
+		return true
+	}
+	return snippet.Visibility == models.VisibilityUnlisted &&
+		snippet.ShareTokenMatches(request.URL.Query().Get(shareTokenParam))
+}
+
+// canReadSnippet reports whether the content of a snippet the request may see
+// can be shown on the pages reading it by ID, like its history and diffs,
+// without going through its link first: not when it is password protected
+// and still locked, nor when it burns after reading (but to its owner) or has
+// burned already.
+func canReadSnippet(app *config.Application, request *http.Request, snippet *models.Snippet) bool {
+	if snippet.Burned() || snippetLocked(app, request, snippet) {
+		return false
+	}
+	return !snippet.BurnAfterReading || app.SnippetKey(request, snippet.ID) != ""
+}
+
+// renderSnippetEdit re-displays the edit page for a snippet with the given form.
+func renderSnippetEdit(app *config.Application, responseWriter http.ResponseWriter, request *http.Request, status int, snippet *models.Snippet, form editSnippetFormData) {
+	data := app.NewTemplateData(request)
+	data.Snippet = snippet
+	data.Form = form
+	data.CanManage = app.SnippetKey(request, snippet.ID) != ""
+	app.Render(responseWriter, request, status, "edit.html", data)
+}
+
+// snippetManage shows the form which presents the management key of a
+// snippet, where the management link handed out at creation time leads. The
+// link holds the key in its fragment, which browsers don't send (nor log, nor
+// pass on as the referrer), and /static/js/main.js posts it from there.
+func snippetManage(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, err := strconv.Atoi(request.PathValue("id"))
+		if err != nil || id < 1 {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		data := app.NewTemplateData(request)
+		data.Snippet = snippet
+		data.Form = manageSnippetFormData{}
+		app.Render(responseWriter, request, http.StatusOK, "manage.html", data)
+	}
+}
+
+// snippetManagePost remembers the management key of a snippet in the session
+// and moves on to its edit page.
+func snippetManagePost(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, err := strconv.Atoi(request.PathValue("id"))
+		if err != nil || id < 1 {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		var form manageSnippetFormData
+		err = app.DecodePostForm(request, &form)
+		if err != nil {
+			app.ClientError(responseWriter, http.StatusBadRequest)
+			return
+		}
+
+		allowed, err := canManageSnippet(app, request, id, form.Key)
+		if err != nil {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
+		if !allowed {
+			form.AddFieldError("key", "This is not the management key of this snippet")
+
+			data := app.NewTemplateData(request)
+			data.Snippet = snippet
+			data.Form = manageSnippetFormData{Validator: form.Validator}
+			app.Render(responseWriter, request, http.StatusUnprocessableEntity, "manage.html", data)
+			return
+		}
+
+		http.Redirect(responseWriter, request, "/snippet/edit/"+strconv.Itoa(id), http.StatusSeeOther)
+	}
+}
+
+func snippetEdit(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, err := strconv.Atoi(request.PathValue("id"))
+		if err != nil || id < 1 {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		if !canViewSnippet(app, request, snippet) {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		renderSnippetEdit(app, responseWriter, request, http.StatusOK, snippet, editSnippetFormData{
+			Title:   snippet.Title,
+			Content: snippet.Content,
+		})
+	}
+}
+
+func snippetEditPost(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, err := strconv.Atoi(request.PathValue("id"))
+		if err != nil || id < 1 {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		var form editSnippetFormData
+		err = app.DecodePostForm(request, &form)
+		if err != nil {
+			app.ClientError(responseWriter, http.StatusBadRequest)
+			return
+		}
+
+		// only the title of encrypted snippets can be edited, as the server
+		// can't decrypt their content
+		if snippet.Encrypted {
+			form.Content = snippet.Content
+		}
+
+		form.Validator.CheckField(validator.NotBlank(form.Title), "title", "This field cannot be blank")
+		form.Validator.CheckField(validator.MaxChars(form.Title, 100), "title", "This field cannnot be more than 100 characters long")
+		form.Validator.CheckField(validator.NotBlank(form.Content), "content", "This field cannot be blank")
+		form.Validator.CheckField(len(form.Content) <= models.MaxContentBytes, "content", "This field cannot be more than 48000 bytes long")
+
+		allowed, err := canManageSnippet(app, request, id, form.Key)
+		if err != nil {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
+		if !allowed && !canViewSnippet(app, request, snippet) {
+			app.NotFound(responseWriter)
+			return
+		}
+		form.Validator.CheckField(allowed, "key", "This is not the management key of this snippet")
+
+		if !form.Valid() {
+			renderSnippetEdit(app, responseWriter, request, http.StatusUnprocessableEntity, snippet, form)
+			return
+		}
+
+		err = app.Snippets.Update(request.Context(), id, form.Title, form.Content)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		app.SessionManager.Put(request.Context(), "flash", "Snippet successfully updated!")
+		http.Redirect(responseWriter, request, snippetPath(snippet), http.StatusSeeOther)
+	}
+}
+
+func snippetDeletePost(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		id, err := strconv.Atoi(request.PathValue("id"))
+		if err != nil || id < 1 {
+			app.NotFound(responseWriter)
+			return
+		}
+
+		snippet, err := app.Snippets.Get(request.Context(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.NotFound(responseWriter)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		var form editSnippetFormData
+		err = app.DecodePostForm(request, &form)
+		if err != nil {
+			app.ClientError(responseWriter, http.StatusBadRequest)
+			return
+		}
+
+		allowed, err := canManageSnippet(app, request, id, form.Key)
+		if err != nil {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
+		if !allowed && !canViewSnippet(app, request, snippet) {
+			app.NotFound(responseWriter)
+			return
+		}
+		if !allowed {
+			form.Title, form.Content = snippet.Title, snippet.Content
+			form.AddNonFieldError("The snippet was not deleted: that is not its management key")
+			renderSnippetEdit(app, responseWriter, request, http.StatusUnprocessableEntity, snippet, form)
+			return
+		}
+
+		err = app.Snippets.Delete(request.Context(), id)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
+
+		app.SessionManager.Put(request.Context(), "flash", "Snippet successfully deleted!")
+		http.Redirect(responseWriter, request, "/", http.StatusSeeOther)
+	}
+}
+
+// userSignupFormData represents the signup form data and its validation errors.
+type userSignupFormData struct {
+	Name                string `form:"name"`
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+// userLoginFormData represents the login form data and its validation errors.
+type userLoginFormData struct {
+	Email               string `form:"email"`
+	Password            string `form:"password"`
+	validator.Validator `form:"-"`
+}
+
+func userSignup(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		data := app.NewTemplateData(request)
+		data.Form = userSignupFormData{}
+		app.Render(responseWriter, request, http.StatusOK, "signup.html", data)
+	}
+}
+
+func userSignupPost(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		var form userSignupFormData
+		err := app.DecodePostForm(request, &form)
+		if err != nil {
+			app.ClientError(responseWriter, http.StatusBadRequest)
+			return
+		}
+
+		form.Validator.CheckField(validator.NotBlank(form.Name), "name", "This field cannot be blank")
+		form.Validator.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+		form.Validator.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+		form.Validator.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+		form.Validator.CheckField(validator.MinChars(form.Password, 8), "password", "This field must be at least 8 characters long")
+		form.Validator.CheckField(len(form.Password) <= maxPasswordBytes, "password", "This field cannot be more than 72 bytes long")
+
+		if !form.Valid() {
+			data := app.NewTemplateData(request)
+			data.Form = form
+			app.Render(responseWriter, request, http.StatusUnprocessableEntity, "signup.html", data)
+			return
+		}
+
+		// Try to create a new user record. If the email is already in use,
+		// add an error message to the form and re-display it.
+		err = app.Users.Insert(request.Context(), form.Name, form.Email, form.Password)
+		if err != nil {
+			if errors.Is(err, models.ErrDuplicateEmail) {
+				form.AddFieldError("email", "Email address is already in use")
+
+				data := app.NewTemplateData(request)
+				data.Form = form
+				app.Render(responseWriter, request, http.StatusUnprocessableEntity, "signup.html", data)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		app.SessionManager.Put(request.Context(), "flash", "Your signup was successful. Please log in.")
+		http.Redirect(responseWriter, request, "/user/login", http.StatusSeeOther)
+	}
+}
+
+func userLogin(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		data := app.NewTemplateData(request)
+		data.Form = userLoginFormData{}
+		app.Render(responseWriter, request, http.StatusOK, "login.html", data)
+	}
+}
+
+func userLoginPost(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		var form userLoginFormData
+		err := app.DecodePostForm(request, &form)
+		if err != nil {
+			app.ClientError(responseWriter, http.StatusBadRequest)
+			return
+		}
+
+		form.Validator.CheckField(validator.NotBlank(form.Email), "email", "This field cannot be blank")
+		form.Validator.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "This field must be a valid email address")
+		form.Validator.CheckField(validator.NotBlank(form.Password), "password", "This field cannot be blank")
+
+		if !form.Valid() {
+			data := app.NewTemplateData(request)
+			data.Form = form
+			app.Render(responseWriter, request, http.StatusUnprocessableEntity, "login.html", data)
+			return
+		}
+
+		// Check whether the credentials are valid. If they're not, add a generic
+		// non-field error message and re-display the login page.
+		id, err := app.Users.Authenticate(request.Context(), form.Email, form.Password)
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidCredentials) {
+				form.AddNonFieldError("Email or password is incorrect")
+
+				data := app.NewTemplateData(request)
+				data.Form = form
+				app.Render(responseWriter, request, http.StatusUnprocessableEntity, "login.html", data)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		// Use the RenewToken() method on the current session to change the session
+		// ID. It's good practice to generate a new session ID when the
+		// authentication state or privilege levels changes for the user (e.g. login
+		// and logout operations), as it prevents session fixation attacks.
+		err = app.SessionManager.RenewToken(request.Context())
+		if err != nil {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
+
+		app.SessionManager.Put(request.Context(), config.AuthenticatedUserIDSessionKey, id)
+		http.Redirect(responseWriter, request, "/snippet/create", http.StatusSeeOther)
+	}
+}
+
+func userLogoutPost(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		// change the session ID again now the authentication state changes
+		err := app.SessionManager.RenewToken(request.Context())
+		if err != nil {
+			app.ServerError(responseWriter, request, err)
+			return
+		}
+
+		app.SessionManager.Remove(request.Context(), config.AuthenticatedUserIDSessionKey)
+		app.SessionManager.Put(request.Context(), "flash", "You've been logged out successfully!")
+		http.Redirect(responseWriter, request, "/", http.StatusSeeOther)
+	}
+}
+
+func userProfile(app *config.Application) http.HandlerFunc {
+	return func(responseWriter http.ResponseWriter, request *http.Request) {
+		// the authenticate middleware already loaded the user for the template
+		app.Render(responseWriter, request, http.StatusOK, "profile.html", app.NewTemplateData(request))
 	}
 }
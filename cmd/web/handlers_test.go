@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"fcc-project/cmd/config"
+	"fcc-project/internal/models"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// insertSnippet stores a snippet in store and returns it.
+func insertSnippet(t *testing.T, store models.SnippetStore, title string, content string, visibility models.Visibility) *models.Snippet {
+	t.Helper()
+
+	id, _, err := store.Insert(context.Background(), title, content, 7, visibility, false, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippet, err := store.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snippet
+}
+
+func TestHome(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, routes(app))
+
+	status, _, body := ts.get(t, "/")
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+	if !strings.Contains(body, "There's nothing to see here... yet!") {
+		t.Errorf("want the empty listing, got:\n%s", body)
+	}
+
+	insertSnippet(t, app.Snippets, "An old silent pond", "An old silent pond...", models.VisibilityPublic)
+	insertSnippet(t, app.Snippets, "Hidden away", "Unlisted content", models.VisibilityUnlisted)
+
+	status, _, body = ts.get(t, "/")
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+	if !strings.Contains(body, "An old silent pond") {
+		t.Errorf("want the public snippet listed, got:\n%s", body)
+	}
+	if strings.Contains(body, "Hidden away") {
+		t.Error("the unlisted snippet is listed")
+	}
+}
+
+func TestSnippetView(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, routes(app))
+
+	public := insertSnippet(t, app.Snippets, "An old silent pond", "An old silent pond...", models.VisibilityPublic)
+	private := insertSnippet(t, app.Snippets, "Diary", "Dear diary", models.VisibilityPrivate)
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Public snippet", "/s/" + public.Slug, http.StatusOK, "An old silent pond..."},
+		{"Private snippet of another session", "/s/" + private.Slug, http.StatusNotFound, ""},
+		{"Unknown slug", "/s/nope", http.StatusNotFound, ""},
+		{"Old link by ID", "/snippet/view/" + strconv.Itoa(public.ID), http.StatusMovedPermanently, ""},
+		{"Old link with invalid ID", "/snippet/view/-1", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := ts.get(t, tt.urlPath)
+			if status != tt.wantCode {
+				t.Errorf("got status %d; want %d", status, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q", tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSnippetCreatePost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, routes(app))
+
+	_, _, body := ts.get(t, "/snippet/create")
+	csrfToken := extractCSRFToken(t, body)
+
+	validForm := func() url.Values {
+		return url.Values{
+			"title":      {"A title"},
+			"content":    {"Some content"},
+			"expires":    {"7"},
+			"visibility": {"public"},
+			"csrf_token": {csrfToken},
+		}
+	}
+
+	t.Run("Missing CSRF token", func(t *testing.T) {
+		form := validForm()
+		form.Del("csrf_token")
+		status, _, _ := ts.postForm(t, "/snippet/create", form)
+		if status != http.StatusBadRequest {
+			t.Errorf("got status %d; want %d", status, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Invalid form", func(t *testing.T) {
+		form := validForm()
+		form.Set("title", "")
+		form.Set("expires", "2")
+		status, _, body := ts.postForm(t, "/snippet/create", form)
+		if status != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+		}
+		if !strings.Contains(body, "This field cannot be blank") {
+			t.Errorf("want the validation errors, got:\n%s", body)
+		}
+	})
+
+	t.Run("Content too long", func(t *testing.T) {
+		form := validForm()
+		form.Set("content", strings.Repeat("x", models.MaxContentBytes+1))
+		status, _, body := ts.postForm(t, "/snippet/create", form)
+		if status != http.StatusUnprocessableEntity {
+			t.Errorf("got status %d; want %d", status, http.StatusUnprocessableEntity)
+		}
+		if !strings.Contains(body, "This field cannot be more than 48000 bytes long") {
+			t.Errorf("want the validation error, got:\n%s", body)
+		}
+	})
+
+	t.Run("Valid form", func(t *testing.T) {
+		status, header, _ := ts.postForm(t, "/snippet/create", validForm())
+		if status != http.StatusSeeOther {
+			t.Fatalf("got status %d; want %d", status, http.StatusSeeOther)
+		}
+		location := header.Get("Location")
+		if !strings.HasPrefix(location, "/s/") {
+			t.Fatalf("got redirect to %q; want the snippet link", location)
+		}
+
+		status, _, body := ts.get(t, location)
+		if status != http.StatusOK {
+			t.Fatalf("got status %d; want %d", status, http.StatusOK)
+		}
+		if !strings.Contains(body, "Some content") {
+			t.Errorf("want the snippet content, got:\n%s", body)
+		}
+		// the management key only ever goes in the fragment of a link
+		if !strings.Contains(body, `href="/snippet/manage/`) || strings.Contains(body, "key=") {
+			t.Errorf("want the management link with the key in its fragment, got:\n%s", body)
+		}
+	})
+}
+
+func TestSnippetDiff(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, routes(app))
+
+	old := insertSnippet(t, app.Snippets, "Old", "first\nsecond\nthird", models.VisibilityPublic)
+	changed := insertSnippet(t, app.Snippets, "New", "first\n2nd\nthird", models.VisibilityPublic)
+	huge := insertSnippet(t, app.Snippets, "Huge", strings.Repeat("line\n", diffMaxLines+1), models.VisibilityPublic)
+
+	diffPath := func(a *models.Snippet, b *models.Snippet) string {
+		return "/snippet/diff?a=" + strconv.Itoa(a.ID) + "&b=" + strconv.Itoa(b.ID)
+	}
+
+	tests := []struct {
+		name     string
+		urlPath  string
+		wantCode int
+		wantBody string
+	}{
+		{"Form only", "/snippet/diff", http.StatusOK, "Compare Snippets"},
+		{"Unified", diffPath(old, changed), http.StatusOK, `<td>2nd</td>`},
+		{"Side by side", diffPath(old, changed) + "&view=split", http.StatusOK, `<td class="insert">2nd</td>`},
+		{"Too large", diffPath(old, huge), http.StatusOK, "too large to be compared"},
+		{"Unknown snippet", "/snippet/diff?a=1&b=99", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := ts.get(t, tt.urlPath)
+			if status != tt.wantCode {
+				t.Errorf("got status %d; want %d", status, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, got:\n%s", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+func TestSnippetHistoryAndDiffGates(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, routes(app))
+
+	insert := func(burnAfterReading bool, password string) *models.Snippet {
+		id, _, err := app.Snippets.Insert(context.Background(), "Secret", "The secret", 7, models.VisibilityPublic, burnAfterReading, password, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snippet, err := app.Snippets.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snippet
+	}
+	public := insertSnippet(t, app.Snippets, "Public", "Nothing to hide", models.VisibilityPublic)
+	locked := insert(false, "pa$$word")
+	burn := insert(true, "")
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantCode     int
+		wantLocation string
+	}{
+		{"History of a locked snippet", "/snippet/history/" + strconv.Itoa(locked.ID), http.StatusSeeOther, "/s/" + locked.Slug},
+		{"History of a burn after reading snippet", "/snippet/history/" + strconv.Itoa(burn.ID), http.StatusSeeOther, "/s/" + burn.Slug},
+		{"Diff with a locked snippet", "/snippet/diff?a=" + strconv.Itoa(public.ID) + "&b=" + strconv.Itoa(locked.ID), http.StatusNotFound, ""},
+		{"Diff with a burn after reading snippet", "/snippet/diff?a=" + strconv.Itoa(burn.ID) + "&b=" + strconv.Itoa(public.ID), http.StatusNotFound, ""},
+		{"History of a public snippet", "/snippet/history/" + strconv.Itoa(public.ID), http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, body := ts.get(t, tt.urlPath)
+			if status != tt.wantCode {
+				t.Errorf("got status %d; want %d", status, tt.wantCode)
+			}
+			if location := header.Get("Location"); location != tt.wantLocation {
+				t.Errorf("got Location %q; want %q", location, tt.wantLocation)
+			}
+			if strings.Contains(body, "The secret") {
+				t.Errorf("the content of the snippet leaked:\n%s", body)
+			}
+		})
+	}
+}
+
+func TestSnippetManage(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, routes(app))
+
+	id, key, err := app.Snippets.Insert(context.Background(), "Diary", "Dear diary", 7, models.VisibilityPrivate, false, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	managePath := "/snippet/manage/" + strconv.Itoa(id)
+	editPath := "/snippet/edit/" + strconv.Itoa(id)
+
+	// the key isn't taken from the query string anymore
+	if status, _, _ := ts.get(t, editPath+"?key="+url.QueryEscape(key)); status != http.StatusNotFound {
+		t.Errorf("got status %d for the key in the query string; want %d", status, http.StatusNotFound)
+	}
+
+	status, _, body := ts.get(t, managePath)
+	if status != http.StatusOK {
+		t.Fatalf("got status %d; want %d", status, http.StatusOK)
+	}
+	if strings.Contains(body, "Dear diary") || strings.Contains(body, "Diary") {
+		t.Errorf("the snippet leaked before its key was presented:\n%s", body)
+	}
+	form := url.Values{"key": {"not the key"}, "csrf_token": {extractCSRFToken(t, body)}}
+
+	status, _, body = ts.postForm(t, managePath, form)
+	if status != http.StatusUnprocessableEntity {
+		t.Errorf("got status %d for the wrong key; want %d", status, http.StatusUnprocessableEntity)
+	}
+	if !strings.Contains(body, "This is not the management key of this snippet") {
+		t.Errorf("want the validation error, got:\n%s", body)
+	}
+
+	form.Set("key", key)
+	status, header, _ := ts.postForm(t, managePath, form)
+	if status != http.StatusSeeOther || header.Get("Location") != editPath {
+		t.Fatalf("got status %d and Location %q; want %d and %q", status, header.Get("Location"), http.StatusSeeOther, editPath)
+	}
+	status, _, body = ts.get(t, editPath)
+	if status != http.StatusOK || !strings.Contains(body, "Dear diary") {
+		t.Errorf("got status %d for the edit page; want %d with the snippet:\n%s", status, http.StatusOK, body)
+	}
+
+	if status, _, _ := ts.get(t, "/snippet/manage/999"); status != http.StatusNotFound {
+		t.Errorf("got status %d for an unknown snippet; want %d", status, http.StatusNotFound)
+	}
+}
+
+// slowSessionStore is a session store taking delay to load and save sessions,
+// which fails like a database would once the context is done.
+type slowSessionStore struct {
+	scs.Store
+	delay time.Duration
+}
+
+func (s slowSessionStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	time.Sleep(s.delay)
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	return s.Store.Find(token)
+}
+
+func (s slowSessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	time.Sleep(s.delay)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Commit(token, b, expiry)
+}
+
+func (s slowSessionStore) DeleteCtx(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Delete(token)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	db := newTestDB(t)
+
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		wantCode int
+	}{
+		{"In time", time.Minute, http.StatusNotFound},
+		// the deadline passes before the database answers
+		{"Past the deadline", time.Nanosecond, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.Snippets = &models.TimeoutSnippetStore{Store: &models.SQLiteSnippetModel{DB: db}, Timeout: tt.timeout}
+			ts := newTestServer(t, routes(app))
+
+			status, _, _ := ts.get(t, "/snippet/history/1")
+			if status != tt.wantCode {
+				t.Errorf("got status %d; want %d", status, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestQueryTimeoutSlowRequest(t *testing.T) {
+	// every query is quick, but the request as a whole takes longer than a
+	// query may
+	const timeout = 50 * time.Millisecond
+	app := newTestApplication(t)
+	app.Snippets = &models.TimeoutSnippetStore{Store: &models.SQLiteSnippetModel{DB: newTestDB(t)}, Timeout: timeout}
+	app.SessionManager.Store = slowSessionStore{Store: app.SessionManager.Store, delay: timeout}
+	ts := newTestServer(t, routes(app))
+	// with a session to load
+	login(t, app, ts)
+
+	id, _, err := app.Snippets.Insert(context.Background(), "Secret", "Read me once", 7, models.VisibilityPublic, true, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snippet, err := app.Snippets.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, body := ts.get(t, "/s/"+snippet.Slug)
+	form := url.Values{"csrf_token": {extractCSRFToken(t, body)}}
+	status, _, body := ts.postForm(t, "/s/"+snippet.Slug, form)
+	if status != http.StatusOK || !strings.Contains(body, "Read me once") {
+		t.Fatalf("got status %d; want %d with the burned snippet:\n%s", status, http.StatusOK, body)
+	}
+
+	// it was shown, and is gone for good
+	status, _, _ = ts.get(t, "/s/"+snippet.Slug)
+	if status != http.StatusGone {
+		t.Errorf("got status %d reading it again; want %d", status, http.StatusGone)
+	}
+}
+
+func TestUserSignupPost(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, routes(app))
+
+	_, _, body := ts.get(t, "/user/signup")
+	csrfToken := extractCSRFToken(t, body)
+
+	tests := []struct {
+		name     string
+		password string
+		wantCode int
+		wantBody string
+	}{
+		{"Too short", "pa$$", http.StatusUnprocessableEntity, "This field must be at least 8 characters long"},
+		// bcrypt refuses to hash it
+		{"Too long", strings.Repeat("p", maxPasswordBytes+1), http.StatusUnprocessableEntity, "This field cannot be more than 72 bytes long"},
+		{"Longest", strings.Repeat("p", maxPasswordBytes), http.StatusSeeOther, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{
+				"name":       {"Alice"},
+				"email":      {"alice@example.com"},
+				"password":   {tt.password},
+				"csrf_token": {csrfToken},
+			}
+			status, _, body := ts.postForm(t, "/user/signup", form)
+			if status != tt.wantCode {
+				t.Errorf("got status %d; want %d", status, tt.wantCode)
+			}
+			if !strings.Contains(body, tt.wantBody) {
+				t.Errorf("want body to contain %q, got:\n%s", tt.wantBody, body)
+			}
+		})
+	}
+}
+
+// login signs a user up in the store of app and logs the client of ts in as
+// them, through the login form.
+func login(t *testing.T, app *config.Application, ts *testServer) {
+	t.Helper()
+
+	if err := app.Users.Insert(context.Background(), "Alice", "alice@example.com", "pa$$word"); err != nil {
+		t.Fatal(err)
+	}
+	_, _, body := ts.get(t, "/user/login")
+	form := url.Values{
+		"email":      {"alice@example.com"},
+		"password":   {"pa$$word"},
+		"csrf_token": {extractCSRFToken(t, body)},
+	}
+	status, _, _ := ts.postForm(t, "/user/login", form)
+	if status != http.StatusSeeOther {
+		t.Fatalf("got status %d logging in; want %d", status, http.StatusSeeOther)
+	}
+}
+
+func TestAuthenticatedPages(t *testing.T) {
+	app := newTestApplication(t)
+	ts := newTestServer(t, routes(app))
+	login(t, app, ts)
+
+	// every page has the logout form in its navigation bar
+	for _, urlPath := range []string{"/", "/snippet/create", "/user/profile", "/search?q=pond", "/snippet/diff"} {
+		status, _, body := ts.get(t, urlPath)
+		if status != http.StatusOK {
+			t.Fatalf("GET %s: got status %d; want %d", urlPath, status, http.StatusOK)
+		}
+		if !strings.Contains(body, `<form action="/user/logout" method="POST">`) {
+			t.Errorf("GET %s: want the logout form, got:\n%s", urlPath, body)
+		}
+	}
+
+	_, _, body := ts.get(t, "/")
+	status, header, _ := ts.postForm(t, "/user/logout", url.Values{"csrf_token": {extractCSRFToken(t, body)}})
+	if status != http.StatusSeeOther || header.Get("Location") != "/" {
+		t.Fatalf("got status %d to %q logging out; want %d to /", status, header.Get("Location"), http.StatusSeeOther)
+	}
+
+	status, header, _ = ts.get(t, "/user/profile")
+	if status != http.StatusSeeOther || header.Get("Location") != "/user/login" {
+		t.Errorf("got status %d to %q after logging out; want a redirect to the login page", status, header.Get("Location"))
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// handoffSignal is nil where listeners can't be handed over to another process.
+var handoffSignal os.Signal
+
+// listen returns a new listener on addr.
+func listen(fdEnv string, addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// notifyReady has nobody to notify, as no process hands its listeners over.
+func notifyReady() error {
+	return nil
+}
+
+// handoff isn't supported on this platform.
+func handoff(ln net.Listener, adminLn net.Listener) (int, error) {
+	return 0, errors.New("listener handoff is only supported on Unix")
+}
@@ -0,0 +1,139 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// handoffSignal tells the server to hand its listeners over to a new process
+// and shut down, see serve.
+var handoffSignal os.Signal = syscall.SIGUSR2
+
+// handoffReadyTimeout is how long handoff waits for the new process to be
+// ready before giving up on it.
+const handoffReadyTimeout = 30 * time.Second
+
+// listen returns the listener to serve on: the one inherited from the process
+// which handed it over, as the file descriptor named by fdEnv, or else a new
+// one on addr.
+func listen(fdEnv string, addr string) (net.Listener, error) {
+	value := os.Getenv(fdEnv)
+	if value == "" {
+		return net.Listen("tcp", addr)
+	}
+	os.Unsetenv(fdEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", fdEnv, err)
+	}
+	// FileListener works on a duplicate of the descriptor, so the file can go
+	f := os.NewFile(uintptr(fd), "listener")
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// notifyReady tells the process which handed its listeners over, if any, that
+// this one is serving them, so it can shut down.
+func notifyReady() error {
+	value := os.Getenv(readyFDEnv)
+	if value == "" {
+		return nil
+	}
+	os.Unsetenv(readyFDEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", readyFDEnv, err)
+	}
+	f := os.NewFile(uintptr(fd), "ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// handoff starts a new process running the same command with the same
+// arguments and environment, passing it the listening sockets of ln and
+// adminLn (which may be nil), and returns its PID once it is ready to serve
+// them. Both processes accept connections from the sockets until this one
+// closes its listeners. When the new process exits, or isn't ready within
+// handoffReadyTimeout, it is stopped and handoff fails: this process must
+// then keep serving.
+func handoff(ln net.Listener, adminLn net.Listener) (int, error) {
+	var files []*os.File
+	var env []string
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	// the extra files of the new process start at file descriptor 3
+	inherit := func(fdEnv string, f *os.File) {
+		env = append(env, fdEnv+"="+strconv.Itoa(3+len(files)))
+		files = append(files, f)
+	}
+
+	for _, l := range []struct {
+		fdEnv string
+		ln    net.Listener
+	}{{listenerFDEnv, ln}, {adminListenerFDEnv, adminLn}} {
+		if l.ln == nil {
+			continue
+		}
+		tcpListener, ok := l.ln.(*net.TCPListener)
+		if !ok {
+			return 0, errors.New("only TCP listeners can be handed over")
+		}
+		f, err := tcpListener.File()
+		if err != nil {
+			return 0, err
+		}
+		inherit(l.fdEnv, f)
+	}
+
+	// the new process writes to the pipe once it serves (see notifyReady);
+	// if it exits first, the pipe is closed without a byte being written
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer ready.Close()
+	inherit(readyFDEnv, readyWriter)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), env...)
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	// only the new process may keep the write end open, or the pipe would
+	// never be closed when it exits
+	readyWriter.Close()
+
+	ready.SetReadDeadline(time.Now().Add(handoffReadyTimeout))
+	if _, err := ready.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if errors.Is(err, io.EOF) {
+			return 0, errors.New("the new process exited before it was ready")
+		}
+		return 0, fmt.Errorf("the new process didn't get ready: %w", err)
+	}
+	return cmd.Process.Pid, nil
+}
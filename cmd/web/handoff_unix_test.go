@@ -0,0 +1,72 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// inheritFD sets env to a duplicate of the descriptor of f, as handoff passes
+// descriptors to the new process. The function reading env closes it.
+func inheritFD(t *testing.T, env string, f *os.File) {
+	t.Helper()
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(env, strconv.Itoa(fd))
+}
+
+func TestListenInherited(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	inheritFD(t, listenerFDEnv, f)
+	inherited, err := listen(listenerFDEnv, "address-not-used:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	if inherited.Addr().String() != ln.Addr().String() {
+		t.Errorf("got listener on %s; want the inherited one on %s", inherited.Addr(), ln.Addr())
+	}
+	if os.Getenv(listenerFDEnv) != "" {
+		t.Errorf("%s is still set, it would be passed on to the next process", listenerFDEnv)
+	}
+}
+
+func TestNotifyReady(t *testing.T) {
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ready.Close()
+	inheritFD(t, readyFDEnv, readyWriter)
+	readyWriter.Close()
+
+	if err := notifyReady(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ready.Read(make([]byte, 1)); n != 1 || err != nil {
+		t.Errorf("got %d bytes and error %v; want the readiness byte", n, err)
+	}
+	// notifyReady closed its end, as the new process must for the old one
+	// to see it exit
+	if _, err := ready.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("got error %v; want io.EOF", err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fcc-project/internal/models"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+)
+
+// keysEnv is the environment variable holding the key ring when no -keys-file
+// is given, with its entries separated by commas.
+const keysEnv = "SNIPPETBOX_KEYS"
+
+const rotateKeysUsage = "usage: web [flags] rotate-keys [BATCH_SIZE]"
+
+// defaultRotationBatch is the number of rows rotate-keys re-encrypts per transaction.
+const defaultRotationBatch = 100
+
+// loadKeyRing returns the key ring encrypting snippet content at rest, read
+// from path or, when path is empty, from the SNIPPETBOX_KEYS environment
+// variable. It returns nil when neither is set, which stores content as plain text.
+func loadKeyRing(path string) (*models.KeyRing, error) {
+	text := os.Getenv(keysEnv)
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	if text == "" {
+		return nil, nil
+	}
+	return models.ParseKeyRing(text)
+}
+
+// runRotateKeys implements the `rotate-keys` subcommand, which re-encrypts
+// every snippet and revision not encrypted with the current key yet (plain
+// text rows included), one batch per transaction, so the server can keep
+// running meanwhile. Keys can be dropped from the key ring once it is done.
+func runRotateKeys(snippets models.SnippetStore, driver string, args []string, logger *slog.Logger) error {
+	rotator, ok := snippets.(models.KeyRotator)
+	if !ok {
+		return fmt.Errorf("the %s driver doesn't encrypt snippets at rest", driver)
+	}
+	if len(args) > 1 {
+		return errors.New(rotateKeysUsage)
+	}
+	batchSize := defaultRotationBatch
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid batch size %q", args[0])
+		}
+		batchSize = n
+	}
+
+	total := 0
+	for {
+		n, err := rotator.RotateKeys(context.Background(), batchSize)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+		logger.Info("rows re-encrypted", "count", n, "total", total)
+	}
+	logger.Info("key rotation done", "total", total)
+	return nil
+}
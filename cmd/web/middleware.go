@@ -1,9 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fcc-project/cmd/config"
+	"fcc-project/internal/models"
 	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/justinas/nosurf"
 )
 
 func secureHeaders(next http.Handler) http.Handler {
@@ -20,14 +31,208 @@ func secureHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// requestIDRX matches the request IDs accepted from the X-Request-ID header.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestID tags every request with an ID: the one in its X-Request-ID header
+// (set by a proxy in front of the application) when it looks sane, or else a
+// new random one. The ID is sent back in the X-Request-ID response header, and
+// added to the RequestInfo in the request context so every log line of the
+// request carries it.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(config.RequestIDHeader)
+		if !requestIDRX.MatchString(id) {
+			id = newRequestID()
+		}
+		responseWriter.Header().Set(config.RequestIDHeader, id)
+
+		info := &config.RequestInfo{
+			ID:     id,
+			Method: request.Method,
+			Path:   request.URL.Path,
+			Start:  time.Now(),
+		}
+		ctx := context.WithValue(request.Context(), config.RequestInfoContextKey, info)
+		next.ServeHTTP(responseWriter, request.WithContext(ctx))
+	})
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 12)
+	// crypto/rand.Read never fails on the platforms Go supports
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// logRequest logs every request once it has been served, with the status code
+// of the response, which it records in the RequestInfo of the request as it is
+// written. It must run inside requestID.
 func logRequest(next http.Handler, app *config.Application) http.Handler {
 	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
-		fmt.Println(request.URL.RequestURI())
-		app.InfoLog.Printf("%s - %s %s %s", request.RemoteAddr, request.Proto, request.Method, request.URL.RequestURI())
+		recorder := &statusRecorder{ResponseWriter: responseWriter, info: config.RequestInfoFromContext(request.Context())}
+		next.ServeHTTP(recorder, request)
+		app.Logger.InfoContext(request.Context(), "request served",
+			"remote_addr", request.RemoteAddr, "proto", request.Proto, "query", redactQuery(request.URL.RawQuery))
+	})
+}
+
+// secretParams are the query parameters holding secrets, which must not end
+// up in the logs: management keys and the share tokens of unlisted snippets.
+var secretParams = []string{"key", shareTokenParam}
+
+// redactQuery returns rawQuery with the values of secretParams replaced, for
+// logging. Queries which don't parse are left out altogether.
+func redactQuery(rawQuery string) string {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "[unparsable]"
+	}
+	for _, param := range secretParams {
+		if values, ok := query[param]; ok {
+			for i := range values {
+				values[i] = "REDACTED"
+			}
+		}
+	}
+	return query.Encode()
+}
+
+// routePattern returns the pattern of the route of mux serving request, like
+// "GET /s/{slug}", or "unmatched" when no route matches it.
+func routePattern(mux *http.ServeMux, request *http.Request) string {
+	_, pattern := mux.Handler(request)
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
+
+// instrument counts and times every request in app.Metrics, by the pattern of
+// the route of mux serving it. It must run inside logRequest, which records
+// the status code of the response.
+func instrument(next http.Handler, mux *http.ServeMux, app *config.Application) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		// the patterns are those of routes(), so the number of label values is bounded
+		route := routePattern(mux, request)
+
+		start := time.Now()
 		next.ServeHTTP(responseWriter, request)
+
+		status := config.RequestInfoFromContext(request.Context()).Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		app.Metrics.Requests.WithLabelValues(route, statusClass(status)).Inc()
+		app.Metrics.RequestDuration.WithLabelValues(route).Observe(time.Since(start).Seconds())
 	})
 }
 
+// statusClass returns the class of an HTTP status code, like "2xx" for 200.
+func statusClass(status int) string {
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+// statusRecorder records the status code of a response in its RequestInfo.
+type statusRecorder struct {
+	http.ResponseWriter
+	info *config.RequestInfo
+}
+
+func (recorder *statusRecorder) WriteHeader(status int) {
+	if recorder.info.Status == 0 {
+		recorder.info.Status = status
+	}
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *statusRecorder) Write(b []byte) (int, error) {
+	if recorder.info.Status == 0 {
+		recorder.info.Status = http.StatusOK
+	}
+	return recorder.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// authenticateToken checks the API token of requests with an
+// "Authorization: Bearer <token>" header and adds it to the request context,
+// where config.APIToken picks it up. Requests without the header pass through
+// untouched, but a malformed header or an unknown token is rejected with a 401.
+func authenticateToken(next http.Handler, app *config.Application) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.Header().Add("Vary", "Authorization")
+
+		header := request.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(responseWriter, request)
+			return
+		}
+
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			responseWriter.Header().Set("WWW-Authenticate", "Bearer")
+			app.APIErrorResponse(responseWriter, http.StatusUnauthorized, "the Authorization header must have the form: Bearer <token>")
+			return
+		}
+
+		apiToken, err := app.Tokens.Authenticate(request.Context(), strings.TrimSpace(token))
+		if err != nil {
+			if errors.Is(err, models.ErrInvalidToken) {
+				responseWriter.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				app.APIErrorResponse(responseWriter, http.StatusUnauthorized, "invalid or revoked API token")
+			} else {
+				app.APIServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(request.Context(), config.APITokenContextKey, apiToken)
+		next.ServeHTTP(responseWriter, request.WithContext(ctx))
+	})
+}
+
+// requireTokenScope only lets requests through which were authenticated with
+// an API token allowing the given scope.
+func requireTokenScope(next http.Handler, app *config.Application, scope models.TokenScope) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		token := app.APIToken(request)
+		if token == nil {
+			responseWriter.Header().Set("WWW-Authenticate", "Bearer")
+			app.APIErrorResponse(responseWriter, http.StatusUnauthorized, "this endpoint requires an API token")
+			return
+		}
+		if !token.Scope.Allows(scope) {
+			responseWriter.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			app.APIErrorResponse(responseWriter, http.StatusForbidden, fmt.Sprintf("this endpoint requires an API token with the %s scope", scope))
+			return
+		}
+		next.ServeHTTP(responseWriter, request)
+	})
+}
+
+// noSurf protects the wrapped handlers against cross-site request forgery. Every
+// request other than GET, HEAD, OPTIONS and TRACE must post back the token
+// from the CSRF cookie in its csrf_token form field (or X-CSRF-Token header).
+func noSurf(next http.Handler, app *config.Application) http.Handler {
+	csrfHandler := nosurf.New(next)
+	csrfHandler.SetBaseCookie(http.Cookie{
+		HttpOnly: true,
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	csrfHandler.SetFailureHandler(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		app.ClientError(responseWriter, http.StatusBadRequest)
+		app.Logger.WarnContext(request.Context(), "CSRF check failed", "reason", nosurf.Reason(request))
+	}))
+	return csrfHandler
+}
+
 func recoverFromPanic(next http.Handler, app *config.Application) http.Handler {
 	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
 		// Create a deferred function (which will always be run in the event
@@ -36,13 +241,62 @@ func recoverFromPanic(next http.Handler, app *config.Application) http.Handler {
 			// Use the builtin recover function to check if there has been a
 			// panic or not. If there has...
 			if err := recover(); err != nil {
+				app.Metrics.Panics.Inc()
 				// Set a "Connection: close" header on the response.
 				responseWriter.Header().Set("Connection", "close")
 				// Call the app.serverError helper method to return a 500
-				// Internal Server response.
-				app.ServerError(responseWriter, fmt.Errorf("%s", err))
+				// Internal Server response, as JSON for API clients.
+				if strings.HasPrefix(request.URL.Path, "/api/") {
+					app.APIServerError(responseWriter, request, fmt.Errorf("%s", err))
+					return
+				}
+				app.ServerError(responseWriter, request, fmt.Errorf("%s", err))
 			}
 		}()
 		next.ServeHTTP(responseWriter, request)
 	})
 }
+
+// authenticate loads the user whose ID is stored in the session and adds them
+// to the request context, where handlers and NewTemplateData can pick them up.
+// It must run inside SessionManager.LoadAndSave.
+func authenticate(next http.Handler, app *config.Application) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		id := app.SessionManager.GetInt(request.Context(), config.AuthenticatedUserIDSessionKey)
+		if id == 0 {
+			next.ServeHTTP(responseWriter, request)
+			return
+		}
+
+		user, err := app.Users.Get(request.Context(), id)
+		if err != nil {
+			// the account has gone away since the user logged in, so treat
+			// the request as coming from an anonymous visitor
+			if errors.Is(err, models.ErrNoRecord) {
+				app.SessionManager.Remove(request.Context(), config.AuthenticatedUserIDSessionKey)
+				next.ServeHTTP(responseWriter, request)
+			} else {
+				app.ServerError(responseWriter, request, err)
+			}
+			return
+		}
+
+		ctx := context.WithValue(request.Context(), config.AuthenticatedUserContextKey, user)
+		next.ServeHTTP(responseWriter, request.WithContext(ctx))
+	})
+}
+
+// requireAuthentication redirects anonymous visitors to the login page.
+func requireAuthentication(next http.Handler, app *config.Application) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if !app.IsAuthenticated(request) {
+			http.Redirect(responseWriter, request, "/user/login", http.StatusSeeOther)
+			return
+		}
+
+		// pages which require authentication shouldn't be stored in the
+		// browser cache (or other intermediary cache).
+		responseWriter.Header().Add("Cache-Control", "no-store")
+		next.ServeHTTP(responseWriter, request)
+	})
+}
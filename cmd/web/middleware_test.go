@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogRequestRedactsSecrets(t *testing.T) {
+	app := newTestApplication(t)
+	var logs bytes.Buffer
+	app.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	ts := newTestServer(t, routes(app))
+
+	const secret = "s3cr3t-management-key"
+	for _, urlPath := range []string{
+		"/snippet/edit/1?key=" + secret,
+		"/snippet/view/1?share=" + secret + "&revision=2",
+	} {
+		ts.get(t, urlPath)
+	}
+
+	if strings.Contains(logs.String(), secret) {
+		t.Errorf("the logs hold a secret:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "revision=2") {
+		t.Errorf("want the other query parameters logged, got:\n%s", logs.String())
+	}
+}
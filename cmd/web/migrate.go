@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fcc-project/internal/migrations"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+const migrateUsage = "usage: web [flags] migrate up|down|status|to N"
+
+// runMigrate implements the `migrate` subcommand, which applies, reverts or
+// reports on the embedded schema migrations for the selected driver.
+func runMigrate(db *sql.DB, driver string, args []string, logger *slog.Logger) error {
+	if db == nil {
+		return fmt.Errorf("the %s driver has no database to migrate", driver)
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := migrations.New(db, driver)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	switch args[0] {
+	case "up":
+		count, err = migrator.Up()
+	case "down":
+		count, err = migrator.Down()
+	case "to":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			return fmt.Errorf("invalid migration version %q", args[1])
+		}
+		count, err = migrator.To(version)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if status.Applied {
+				logger.Info("migration applied", "version", status.Version, "name", status.Name, "applied_at", status.AppliedAt)
+			} else {
+				logger.Info("migration pending", "version", status.Version, "name", status.Name)
+			}
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	// report partial progress even when a migration failed half way through
+	logger.Info("migrations run", "count", count)
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fcc-project/cmd/config"
+	"time"
+)
+
+// startReaper starts the background worker which purges the snippets expired
+// for longer than grace, right away and then every interval. Snippets are
+// deleted batchSize at a time, so no single statement holds its locks for
+// long. The returned function stops the worker, waiting for the batch in
+// progress (if any) to finish.
+func startReaper(app *config.Application, interval time.Duration, grace time.Duration, batchSize int) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			reap(app, grace, batchSize, stop)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// reap purges expired snippets batch by batch, until none are left or the
+// reaper is stopped, and logs how many it purged.
+func reap(app *config.Application, grace time.Duration, batchSize int, stop <-chan struct{}) {
+	before := time.Now().Add(-grace)
+
+	total := 0
+	for {
+		n, err := app.Snippets.PurgeExpired(context.Background(), before, batchSize)
+		if err != nil {
+			app.Logger.Error("purging expired snippets", "error", err)
+			break
+		}
+		total += n
+		if n < batchSize || stopped(stop) {
+			break
+		}
+	}
+
+	if total > 0 {
+		app.Logger.Info("expired snippets purged", "count", total)
+	}
+}
+
+// stopped reports whether stop has been closed, without blocking.
+func stopped(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
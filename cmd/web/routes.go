@@ -2,7 +2,10 @@ package main
 
 import (
 	"fcc-project/cmd/config"
+	"fcc-project/internal/models"
 	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // The routes() method returns a servemux containing our application routes.
@@ -13,22 +16,155 @@ func routes(app *config.Application) http.Handler {
 	// any routes that matches /static/a/b/...
 	mux.Handle("GET /static/{filePath...}", http.StripPrefix("/static", fileServer))
 
+	// dynamic wraps the handlers of every page using sessions: it loads and
+	// saves the session, checks the CSRF token of form posts, then looks up
+	// the logged in user.
+	dynamic := func(handler http.Handler) http.Handler {
+		return app.SessionManager.LoadAndSave(noSurf(authenticate(handler, app), app))
+	}
+	// protected wraps the handlers which are only available to logged in users.
+	protected := func(handler http.Handler) http.Handler {
+		return dynamic(requireAuthentication(handler, app))
+	}
+
 	mux.Handle(
 		"GET /{$}",
-		app.SessionManager.LoadAndSave(home(app)),
+		dynamic(home(app)),
+	)
+	mux.Handle(
+		"GET /snippets",
+		dynamic(home(app)),
+	)
+	mux.Handle(
+		"GET /search",
+		dynamic(snippetSearch(app)),
+	)
+	mux.Handle(
+		"GET /s/{slug}",
+		dynamic(snippetView(app)),
 	)
+	mux.Handle(
+		"POST /s/{slug}",
+		dynamic(snippetBurnPost(app)),
+	)
+	mux.Handle(
+		"POST /s/{slug}/unlock",
+		dynamic(snippetUnlockPost(app)),
+	)
+	// the snippet links from before slugs redirect to the slug links
 	mux.Handle(
 		"GET /snippet/view/{id}",
-		app.SessionManager.LoadAndSave(snippetView(app)),
+		dynamic(snippetViewByID(app)),
 	)
 	mux.Handle(
 		"GET /snippet/create",
-		app.SessionManager.LoadAndSave(snippetCreateForm(app)),
+		dynamic(snippetCreateForm(app)),
 	)
 	mux.Handle(
 		"POST /snippet/create",
-		app.SessionManager.LoadAndSave(snippetCreatePost(app)),
+		dynamic(snippetCreatePost(app)),
+	)
+	mux.Handle(
+		"GET /snippet/manage/{id}",
+		dynamic(snippetManage(app)),
+	)
+	mux.Handle(
+		"POST /snippet/manage/{id}",
+		dynamic(snippetManagePost(app)),
+	)
+	mux.Handle(
+		"GET /snippet/edit/{id}",
+		dynamic(snippetEdit(app)),
+	)
+	mux.Handle(
+		"POST /snippet/edit/{id}",
+		dynamic(snippetEditPost(app)),
+	)
+	mux.Handle(
+		"POST /snippet/delete/{id}",
+		dynamic(snippetDeletePost(app)),
+	)
+	mux.Handle(
+		"GET /snippet/diff",
+		dynamic(snippetDiff(app)),
+	)
+	mux.Handle(
+		"GET /snippet/history/{id}",
+		dynamic(snippetHistory(app)),
+	)
+	mux.Handle(
+		"POST /snippet/restore/{id}/{revision}",
+		dynamic(snippetRestorePost(app)),
+	)
+	mux.Handle(
+		"GET /user/signup",
+		dynamic(userSignup(app)),
+	)
+	mux.Handle(
+		"POST /user/signup",
+		dynamic(userSignupPost(app)),
+	)
+	mux.Handle(
+		"GET /user/login",
+		dynamic(userLogin(app)),
+	)
+	mux.Handle(
+		"POST /user/login",
+		dynamic(userLoginPost(app)),
+	)
+	mux.Handle(
+		"POST /user/logout",
+		protected(userLogoutPost(app)),
+	)
+	mux.Handle(
+		"GET /user/profile",
+		protected(userProfile(app)),
 	)
 
-	return recoverFromPanic(logRequest(secureHeaders(mux), app), app)
+	// The JSON API doesn't use sessions, so its handlers aren't wrapped by
+	// dynamic. Reading snippets through it takes an API token with the read
+	// scope, creating, updating and deleting them one with the write scope
+	// (which allows reading too). Updates and deletes also take the management
+	// key of the snippet.
+	mux.Handle(
+		"GET /api/v1/snippets",
+		requireTokenScope(apiSnippetList(app), app, models.ScopeRead),
+	)
+	mux.Handle(
+		"POST /api/v1/snippets",
+		requireTokenScope(apiSnippetCreate(app), app, models.ScopeWrite),
+	)
+	mux.Handle(
+		"GET /api/v1/snippets/{id}",
+		requireTokenScope(apiSnippetView(app), app, models.ScopeRead),
+	)
+	mux.Handle(
+		"GET /api/v1/snippets/slug/{slug}",
+		requireTokenScope(apiSnippetViewBySlug(app), app, models.ScopeRead),
+	)
+	mux.Handle(
+		"PUT /api/v1/snippets/{id}",
+		requireTokenScope(apiSnippetUpdate(app), app, models.ScopeWrite),
+	)
+	mux.Handle(
+		"DELETE /api/v1/snippets/{id}",
+		requireTokenScope(apiSnippetDelete(app), app, models.ScopeWrite),
+	)
+	mux.Handle(
+		"/api/",
+		apiNotFound(app),
+	)
+
+	// requestID, traceRequest and logRequest come first, so the panics
+	// recovered by recoverFromPanic are logged with the request and the trace
+	// they happened in
+	return requestID(traceRequest(logRequest(instrument(recoverFromPanic(secureHeaders(authenticateToken(mux, app)), app), mux, app), app), mux))
+}
+
+// adminRoutes returns the handler of the admin listener, which serves the
+// Prometheus metrics. It is kept off the public listener.
+func adminRoutes(app *config.Application) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(app.Metrics.Registry, promhttp.HandlerOpts{}))
+	return mux
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fcc-project/cmd/config"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// A process started by handoff finds the file descriptors it inherited in its
+// environment: the listener of the server, the one of the admin server, and
+// the write end of the pipe telling the old process it is ready.
+const (
+	listenerFDEnv      = "SNIPPETBOX_LISTENER_FD"
+	adminListenerFDEnv = "SNIPPETBOX_ADMIN_LISTENER_FD"
+	readyFDEnv         = "SNIPPETBOX_READY_FD"
+)
+
+// serve serves HTTPS on ln until the server fails or the process is told to
+// stop. SIGINT and SIGTERM shut the server down gracefully: it stops accepting
+// connections and waits up to shutdownTimeout for the requests in flight to
+// finish, then closes whatever is left. The handoff signal (SIGUSR2) first
+// hands ln and adminLn (the listener of the admin server, if any) over to a
+// new process running the same command, and waits for it to be ready. It
+// keeps accepting connections while this one drains, so a restart drops none.
+func serve(app *config.Application, server *http.Server, ln net.Listener, adminLn net.Listener, shutdownTimeout time.Duration) error {
+	stopSignals := []os.Signal{os.Interrupt, syscall.SIGTERM}
+	if handoffSignal != nil {
+		stopSignals = append(stopSignals, handoffSignal)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, stopSignals...)
+	defer signal.Stop(signals)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ServeTLS(ln, "./tls/cert.pem", "./tls/key.pem")
+	}()
+	// the process which handed the listeners over, if any, may go now
+	if err := notifyReady(); err != nil {
+		app.Logger.Error("notifying the previous process", "error", err)
+	}
+
+	for {
+		select {
+		case err := <-serveErr:
+			return err
+		case sig := <-signals:
+			if sig == handoffSignal {
+				pid, err := handoff(ln, adminLn)
+				if err != nil {
+					// keep serving rather than leave nobody accepting connections
+					app.Logger.Error("handing the listeners over", "error", err)
+					continue
+				}
+				app.Logger.Info("listeners handed over", "pid", pid)
+			}
+			app.Logger.Info("shutting down, waiting for requests in flight", "signal", sig.String(), "timeout", shutdownTimeout)
+			return shutdown(server, shutdownTimeout)
+		}
+	}
+}
+
+// shutdown stops server gracefully, forcibly closing the connections still
+// active after timeout.
+func shutdown(server *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errors.Join(err, server.Close())
+	}
+	return err
+}
+
+// stopSessionCleanup stops the goroutine of the session store deleting
+// expired sessions, so it doesn't outlive the connection pool. Sessions
+// themselves need no flushing: each request commits its session before
+// responding, so they are all saved once the server has drained.
+func stopSessionCleanup(sessionManager *scs.SessionManager) {
+	if store, ok := sessionManager.Store.(interface{ StopCleanup() }); ok {
+		store.StopCleanup()
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"fcc-project/cmd/config"
+	"fcc-project/internal/migrations"
+	"fcc-project/internal/models"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/go-playground/form/v4"
+)
+
+// TestMain runs the tests from the root of the repository, where the
+// templates and static files are looked up, like the server is.
+func TestMain(m *testing.M) {
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestApplication returns an application backed by the memory stores, so
+// the handlers can be exercised without a database. Log lines are dropped.
+func newTestApplication(t *testing.T) *config.Application {
+	t.Helper()
+
+	templateCache, err := config.NewTemplateCache()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gob.Register(map[int]string{})
+	gob.Register(map[int]time.Time{})
+	sessionManager := scs.New()
+	sessionManager.Lifetime = 12 * time.Hour
+
+	return &config.Application{
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Snippets:       models.NewMemorySnippetModel(),
+		Users:          models.NewMemoryUserModel(),
+		Tokens:         models.NewMemoryTokenModel(),
+		TemplateCache:  templateCache,
+		FormDecoder:    form.NewDecoder(),
+		SessionManager: sessionManager,
+		Metrics:        config.NewMetrics(nil, ""),
+	}
+}
+
+// newTestDB returns a migrated SQLite database in a temporary directory, for
+// the tests which need a store honoring the deadlines of queries.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := config.OpenDB("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator, err := migrations.New(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testServer is an HTTPS test server, with a client keeping the cookies it
+// sets and not following redirects.
+type testServer struct {
+	*httptest.Server
+}
+
+func newTestServer(t *testing.T, handler http.Handler) *testServer {
+	t.Helper()
+
+	ts := httptest.NewTLSServer(handler)
+	t.Cleanup(ts.Close)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.Client().Jar = jar
+	ts.Client().CheckRedirect = func(request *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &testServer{ts}
+}
+
+// do sends request and returns the status code, headers and body of the response.
+func (ts *testServer) do(t *testing.T, request *http.Request) (int, http.Header, string) {
+	t.Helper()
+
+	response, err := ts.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, response.Header, string(bytes.TrimSpace(body))
+}
+
+func (ts *testServer) get(t *testing.T, urlPath string) (int, http.Header, string) {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodGet, ts.URL+urlPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts.do(t, request)
+}
+
+// postForm posts form to urlPath from the same origin, like the forms of the
+// pages do.
+func (ts *testServer) postForm(t *testing.T, urlPath string, form url.Values) (int, http.Header, string) {
+	t.Helper()
+
+	request, err := http.NewRequest(http.MethodPost, ts.URL+urlPath, bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Origin", ts.URL)
+	return ts.do(t, request)
+}
+
+var csrfTokenRX = regexp.MustCompile(`<input type="hidden" name="csrf_token" value="(.+?)" />`)
+
+// extractCSRFToken returns the CSRF token of the first form in body.
+func extractCSRFToken(t *testing.T, body string) string {
+	t.Helper()
+
+	matches := csrfTokenRX.FindStringSubmatch(body)
+	if len(matches) < 2 {
+		t.Fatal("no csrf token found in body")
+	}
+	return html.UnescapeString(matches[1])
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fcc-project/internal/models"
+	"fmt"
+	"log/slog"
+	"strconv"
+)
+
+const tokenUsage = "usage: web [flags] token create NAME read|write | list | revoke ID"
+
+// runToken implements the `token` subcommand, with which an operator mints,
+// lists and revokes the personal API tokens of non-browser clients.
+func runToken(tokens models.TokenStore, driver string, args []string, logger *slog.Logger) error {
+	if driver == "memory" {
+		return errors.New("the memory driver keeps API tokens inside the server process, use a database driver")
+	}
+	if len(args) == 0 {
+		return errors.New(tokenUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		if len(args) != 3 || args[1] == "" {
+			return errors.New(tokenUsage)
+		}
+		scope, ok := models.ParseTokenScope(args[2])
+		if !ok {
+			return fmt.Errorf("invalid token scope %q, must be read or write", args[2])
+		}
+		id, token, err := tokens.Insert(context.Background(), args[1], scope)
+		if err != nil {
+			return err
+		}
+		logger.Info("token created, it won't be shown again", "id", id, "name", args[1], "scope", scope)
+		// print the token on its own on stdout, so scripts can capture it
+		fmt.Println(token)
+		return nil
+	case "list":
+		list, err := tokens.List(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, t := range list {
+			attrs := []any{"id", t.ID, "name", t.Name, "scope", t.Scope, "created", t.Created}
+			if !t.LastUsed.IsZero() {
+				attrs = append(attrs, "last_used", t.LastUsed)
+			}
+			logger.Info("token", attrs...)
+		}
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(tokenUsage)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil || id < 1 {
+			return fmt.Errorf("invalid token ID %q", args[1])
+		}
+		err = tokens.Revoke(context.Background(), id)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				return fmt.Errorf("there is no token %d", id)
+			}
+			return err
+		}
+		logger.Info("token revoked", "id", id)
+		return nil
+	default:
+		return errors.New(tokenUsage)
+	}
+}
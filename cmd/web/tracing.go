@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fcc-project/cmd/config"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of the web layer with the global tracer provider.
+var tracer = otel.Tracer("fcc-project/cmd/web")
+
+// setupTracing installs the global tracer provider, exporting spans to
+// exporter: "none" (spans aren't recorded at all), "stdout" (as JSON, handy
+// in development) or "otlp" (over HTTP, to the collector at
+// $OTEL_EXPORTER_OTLP_ENDPOINT, http://localhost:4318 by default). The
+// returned function exports the spans still buffered and stops the exporter.
+func setupTracing(exporter string) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		spanExporter, err = stdouttrace.New()
+	case "otlp":
+		spanExporter, err = otlptracehttp.New(context.Background())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, must be none, stdout or otlp", exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "snippetbox"))),
+	)
+	otel.SetTracerProvider(provider)
+	// continue the traces of clients sending a traceparent header
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// traceRequest records a span for every request, named after the pattern of
+// the route of mux serving it, continuing the trace of the client when the
+// request has a traceparent header. It must run inside requestID and outside
+// logRequest, so the span gets the status code logRequest records, and the
+// log lines of the request get the trace ID.
+func traceRequest(next http.Handler, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		info := config.RequestInfoFromContext(request.Context())
+		route := routePattern(mux, request)
+
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		ctx, span := tracer.Start(ctx, route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", request.URL.Path),
+				attribute.String("snippetbox.request_id", info.ID),
+			),
+		)
+		defer span.End()
+
+		next.ServeHTTP(responseWriter, request.WithContext(ctx))
+
+		status := info.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// tracedSessionStore wraps the store of the session manager, recording spans
+// for loading, saving and deleting sessions.
+type tracedSessionStore struct {
+	store scs.Store
+}
+
+func (s tracedSessionStore) Find(token string) ([]byte, bool, error) {
+	return s.FindCtx(context.Background(), token)
+}
+
+func (s tracedSessionStore) Commit(token string, b []byte, expiry time.Time) error {
+	return s.CommitCtx(context.Background(), token, b, expiry)
+}
+
+func (s tracedSessionStore) Delete(token string) error {
+	return s.DeleteCtx(context.Background(), token)
+}
+
+func (s tracedSessionStore) FindCtx(ctx context.Context, token string) (b []byte, found bool, err error) {
+	ctx, span := tracer.Start(ctx, "session load")
+	defer func() { endSessionSpan(span, err) }()
+	if store, ok := s.store.(scs.CtxStore); ok {
+		return store.FindCtx(ctx, token)
+	}
+	return s.store.Find(token)
+}
+
+func (s tracedSessionStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) (err error) {
+	ctx, span := tracer.Start(ctx, "session save")
+	defer func() { endSessionSpan(span, err) }()
+	if store, ok := s.store.(scs.CtxStore); ok {
+		return store.CommitCtx(ctx, token, b, expiry)
+	}
+	return s.store.Commit(token, b, expiry)
+}
+
+func (s tracedSessionStore) DeleteCtx(ctx context.Context, token string) (err error) {
+	ctx, span := tracer.Start(ctx, "session delete")
+	defer func() { endSessionSpan(span, err) }()
+	if store, ok := s.store.(scs.CtxStore); ok {
+		return store.DeleteCtx(ctx, token)
+	}
+	return s.store.Delete(token)
+}
+
+// StopCleanup stops the cleanup goroutine of the wrapped store, if it has one.
+func (s tracedSessionStore) StopCleanup() {
+	if store, ok := s.store.(interface{ StopCleanup() }); ok {
+		store.StopCleanup()
+	}
+}
+
+// endSessionSpan records err on span, if any, and ends it.
+func endSessionSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,233 @@
+// Package diff computes line based differences between two texts and lays
+// them out as unified hunks or side-by-side rows.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op says what happened to a line going from the old text to the new one.
+type Op int
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+// String returns the name of the operation, which doubles as a CSS class.
+func (op Op) String() string {
+	switch op {
+	case Delete:
+		return "delete"
+	case Insert:
+		return "insert"
+	default:
+		return "equal"
+	}
+}
+
+// Line is a single line of a diff. OldNumber and NewNumber are the 1-based
+// line numbers in the old and new texts, 0 when the line isn't part of that text.
+type Line struct {
+	Op        Op
+	Text      string
+	OldNumber int
+	NewNumber int
+}
+
+// Lines returns the line by line differences between the old text a and the
+// new text b, as a shortest edit script computed with Myers' algorithm.
+func Lines(a string, b string) []Line {
+	oldLines, newLines := splitLines(a), splitLines(b)
+	ops := groupChanges(myers(nil, oldLines, newLines, newSearch(len(oldLines), len(newLines))))
+
+	// number the lines while walking both texts alongside the operations
+	lines := make([]Line, 0, len(ops))
+	x, y := 0, 0
+	for _, op := range ops {
+		switch op {
+		case Equal:
+			lines = append(lines, Line{Op: Equal, Text: oldLines[x], OldNumber: x + 1, NewNumber: y + 1})
+			x++
+			y++
+		case Delete:
+			lines = append(lines, Line{Op: Delete, Text: oldLines[x], OldNumber: x + 1})
+			x++
+		case Insert:
+			lines = append(lines, Line{Op: Insert, Text: newLines[y], NewNumber: y + 1})
+			y++
+		}
+	}
+	return lines
+}
+
+// Changed reports whether the diff contains any inserted or deleted lines.
+func Changed(lines []Line) bool {
+	for _, line := range lines {
+		if line.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// splitLines splits text into lines, ignoring a trailing newline and treating
+// \r\n line endings (as submitted by browsers) like \n.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// search holds the furthest reaching paths of the forward and backward
+// searches of middleSnake, indexed by diagonal. They are allocated once, for
+// the whole texts, and reused for every part of them myers recurses into.
+type search struct {
+	forward  []int
+	backward []int
+}
+
+// newSearch returns the search state for texts of n and m lines.
+func newSearch(n int, m int) *search {
+	size := (n+m+1)/2 + 1
+	return &search{forward: make([]int, 2*size+1), backward: make([]int, 2*size+1)}
+}
+
+// myers appends to ops the operations of a shortest edit script turning a
+// into b, and returns the extended slice. It is the linear space variant of
+// "An O(ND) Difference Algorithm and Its Variations" by Eugene W. Myers:
+// the middle snake of an optimal path splits the texts in two smaller
+// problems, which are solved recursively. It takes O((N+M)D) time, but only
+// O(N+M) memory, however different the texts are.
+func myers(ops []Op, a []string, b []string, s *search) []Op {
+	// Lines shared at the start and the end are part of every shortest edit
+	// script, so they are kept out of the search.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops = appendOps(ops, Equal, prefix)
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		ops = appendOps(ops, Insert, len(b))
+	case len(b) == 0:
+		ops = appendOps(ops, Delete, len(a))
+	default:
+		// a and b differ at both ends, so at least two edits are needed and
+		// the snake has an edit on either side: both halves are smaller.
+		x, y, u, v := middleSnake(a, b, s)
+		ops = myers(ops, a[:x], b[:y], s)
+		ops = appendOps(ops, Equal, u-x)
+		ops = myers(ops, a[u:], b[v:], s)
+	}
+	return appendOps(ops, Equal, suffix)
+}
+
+// middleSnake returns the middle snake of a shortest edit script turning a
+// into b: the run of equal lines from (x, y) to (u, v) where the searches
+// from the start and from the end of both texts meet.
+func middleSnake(a []string, b []string, s *search) (x, y, u, v int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+
+	// forward[offset+k] is the furthest x reached from (0, 0) on diagonal
+	// k = x-y, and backward[offset+k] the furthest distance reached from
+	// (n, m), going back, on diagonal k = (n-x)-(m-y) = delta-(x-y).
+	half := (n + m + 1) / 2
+	offset := half
+	forward, backward := s.forward[:2*half+2], s.backward[:2*half+2]
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	for d := 0; d <= half; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1] // move down: insert b[y]
+			} else {
+				x = forward[offset+k-1] + 1 // move right: delete a[x]
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+
+			// with an odd delta, the paths meet after a forward move
+			if back := delta - k; odd && back >= -(d-1) && back <= d-1 && x+backward[offset+back] >= n {
+				return startX, startY, x, y
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+
+			// with an even delta, the paths meet after a backward move
+			if ahead := delta - k; !odd && ahead >= -d && ahead <= d && x+forward[offset+ahead] >= n {
+				return n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+	// unreachable: the searches meet by the time they have covered the
+	// n+m edits which always turn a into b
+	panic(fmt.Sprintf("diff: no middle snake found for %d and %d lines", n, m))
+}
+
+// appendOps appends count times op to ops.
+func appendOps(ops []Op, op Op, count int) []Op {
+	for i := 0; i < count; i++ {
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// groupChanges reorders every run of changes so that its deletions come
+// before its insertions, which the layouts expect to pair modified lines up.
+// Any order of a run is an equally short edit script.
+func groupChanges(ops []Op) []Op {
+	for start := 0; start < len(ops); {
+		if ops[start] == Equal {
+			start++
+			continue
+		}
+		end, deleted := start, 0
+		for ; end < len(ops) && ops[end] != Equal; end++ {
+			if ops[end] == Delete {
+				deleted++
+			}
+		}
+		for i := start; i < end; i++ {
+			if i < start+deleted {
+				ops[i] = Delete
+			} else {
+				ops[i] = Insert
+			}
+		}
+		start = end
+	}
+	return ops
+}
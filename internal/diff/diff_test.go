@@ -0,0 +1,163 @@
+package diff
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// format writes a diff like diff -u does, without the headers: one line per
+// line of the diff, prefixed with " ", "-" or "+".
+func format(lines []Line) string {
+	var b strings.Builder
+	for _, line := range lines {
+		switch line.Op {
+		case Equal:
+			b.WriteString(" ")
+		case Delete:
+			b.WriteString("-")
+		case Insert:
+			b.WriteString("+")
+		}
+		b.WriteString(line.Text)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{"Both empty", "", "", ""},
+		{"Identical", "a\nb\n", "a\nb", " a\n b\n"},
+		{"Added to empty", "", "a\nb", "+a\n+b\n"},
+		{"Emptied", "a\nb", "", "-a\n-b\n"},
+		{"Line inserted", "a\nc", "a\nb\nc", " a\n+b\n c\n"},
+		{"Line deleted", "a\nb\nc", "a\nc", " a\n-b\n c\n"},
+		{"Line changed", "a\nb\nc", "a\nx\nc", " a\n-b\n+x\n c\n"},
+		{"Windows line endings", "a\r\nb\r\n", "a\nb\n", " a\n b\n"},
+		{"Lines moved", "a\nb\nc\nd", "c\nd\na\nb", "-a\n-b\n c\n d\n+a\n+b\n"},
+		{"Everything changed", "a\nb", "x\ny\nz", "-a\n-b\n+x\n+y\n+z\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := format(Lines(tt.a, tt.b))
+			if got != tt.want {
+				t.Errorf("got diff:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinesNumbers(t *testing.T) {
+	lines := Lines("a\nb\nc", "a\nx\nc")
+	want := []Line{
+		{Op: Equal, Text: "a", OldNumber: 1, NewNumber: 1},
+		{Op: Delete, Text: "b", OldNumber: 2},
+		{Op: Insert, Text: "x", NewNumber: 2},
+		{Op: Equal, Text: "c", OldNumber: 3, NewNumber: 3},
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines; want %d", len(lines), len(want))
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d: got %+v; want %+v", i, lines[i], want[i])
+		}
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and b.
+func lcs(a []string, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+	return lengths[0][0]
+}
+
+// checkScript fails the test unless lines turns a into b with the given
+// number of changes.
+func checkScript(t *testing.T, a []string, b []string, lines []Line, wantChanges int) {
+	t.Helper()
+
+	var oldLines, newLines []string
+	changes := 0
+	for _, line := range lines {
+		if line.Op != Insert {
+			oldLines = append(oldLines, line.Text)
+		}
+		if line.Op != Delete {
+			newLines = append(newLines, line.Text)
+		}
+		if line.Op != Equal {
+			changes++
+		}
+	}
+	if strings.Join(oldLines, "\n") != strings.Join(a, "\n") || strings.Join(newLines, "\n") != strings.Join(b, "\n") {
+		t.Fatalf("the diff of %q and %q doesn't turn one into the other:\n%s", a, b, format(lines))
+	}
+	if changes != wantChanges {
+		t.Fatalf("the diff of %q and %q has %d changes; want %d:\n%s", a, b, changes, wantChanges, format(lines))
+	}
+}
+
+func TestLinesShortest(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	text := func() []string {
+		lines := make([]string, random.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(3)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := text(), text()
+		// the shortest edit scripts keep the longest common subsequence
+		checkScript(t, a, b, Lines(strings.Join(a, "\n"), strings.Join(b, "\n")), len(a)+len(b)-2*lcs(a, b))
+	}
+}
+
+func TestLinesLarge(t *testing.T) {
+	// unrelated texts have the longest edit scripts, which used to take
+	// memory quadratic in their length
+	a, b := make([]string, 5000), make([]string, 5000)
+	for i := range a {
+		a[i] = "old " + strconv.Itoa(i)
+		b[i] = "new " + strconv.Itoa(i)
+	}
+	// but for a few lines, all of which can be kept
+	common := 0
+	for i := 0; i < len(a); i += 500 {
+		b[i] = a[i]
+		common++
+	}
+
+	lines := Lines(strings.Join(a, "\n"), strings.Join(b, "\n"))
+	checkScript(t, a, b, lines, len(a)+len(b)-2*common)
+}
+
+func TestChanged(t *testing.T) {
+	if Changed(Lines("a\nb", "a\nb")) {
+		t.Error("identical texts changed")
+	}
+	if !Changed(Lines("a\nb", "a\nc")) {
+		t.Error("different texts didn't change")
+	}
+}
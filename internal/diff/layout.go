@@ -0,0 +1,126 @@
+package diff
+
+import "fmt"
+
+// Hunk is a group of changed lines together with some unchanged lines of
+// context around them, as shown in a unified diff.
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []Line
+}
+
+// Header returns the hunk's range header, like "@@ -3,7 +3,8 @@".
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+// Unified groups the changes of a diff into hunks, each surrounded by up to
+// context unchanged lines. Changes closer together than twice the context end
+// up in the same hunk.
+func Unified(lines []Line, context int) []Hunk {
+	var hunks []Hunk
+
+	start, end := -1, -1
+	flush := func() {
+		if start < 0 {
+			return
+		}
+		hunks = append(hunks, newHunk(lines, start, end))
+	}
+
+	for i, line := range lines {
+		if line.Op == Equal {
+			continue
+		}
+		from, to := max(0, i-context), min(len(lines), i+context+1)
+		if start >= 0 && from <= end {
+			// overlaps (or touches) the current hunk, so extend it
+			end = max(end, to)
+			continue
+		}
+		flush()
+		start, end = from, to
+	}
+	flush()
+	return hunks
+}
+
+// newHunk builds the hunk covering lines[start:end].
+func newHunk(lines []Line, start int, end int) Hunk {
+	h := Hunk{Lines: lines[start:end]}
+
+	// count the lines of each text before and inside the hunk
+	oldBefore, newBefore := 0, 0
+	for _, line := range lines[:start] {
+		if line.Op != Insert {
+			oldBefore++
+		}
+		if line.Op != Delete {
+			newBefore++
+		}
+	}
+	for _, line := range h.Lines {
+		if line.Op != Insert {
+			h.OldLines++
+		}
+		if line.Op != Delete {
+			h.NewLines++
+		}
+	}
+
+	// like diff -u, an empty range starts at the line before it
+	h.OldStart, h.NewStart = oldBefore, newBefore
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+	return h
+}
+
+// Row is one row of a side-by-side diff. Left is the line of the old text and
+// Right the line of the new text; either is nil where that side has no line.
+type Row struct {
+	Left  *Line
+	Right *Line
+}
+
+// SideBySide lays a diff out in two columns. Unchanged lines appear on both
+// sides, and each run of deleted lines is paired up with the inserted lines
+// directly following it, so modified lines face each other.
+func SideBySide(lines []Line) []Row {
+	var rows []Row
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			rows = append(rows, Row{Left: &lines[i], Right: &lines[i]})
+			i++
+			continue
+		}
+
+		// collect a run of deletions followed by a run of insertions
+		var deleted, inserted []*Line
+		for ; i < len(lines) && lines[i].Op == Delete; i++ {
+			deleted = append(deleted, &lines[i])
+		}
+		for ; i < len(lines) && lines[i].Op == Insert; i++ {
+			inserted = append(inserted, &lines[i])
+		}
+
+		for j := 0; j < max(len(deleted), len(inserted)); j++ {
+			var row Row
+			if j < len(deleted) {
+				row.Left = deleted[j]
+			}
+			if j < len(inserted) {
+				row.Right = inserted[j]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
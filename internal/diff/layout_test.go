@@ -0,0 +1,73 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13"
+
+	hunks := Unified(Lines(a, b), 2)
+	if len(hunks) != 2 {
+		t.Fatalf("got %d hunks; want 2", len(hunks))
+	}
+
+	tests := []struct {
+		header string
+		diff   string
+	}{
+		{"@@ -1,5 +1,5 @@", " 1\n 2\n-3\n+three\n 4\n 5\n"},
+		{"@@ -11,2 +11,3 @@", " 11\n 12\n+13\n"},
+	}
+	for i, tt := range tests {
+		if got := hunks[i].Header(); got != tt.header {
+			t.Errorf("hunk %d: got header %q; want %q", i, got, tt.header)
+		}
+		if got := format(hunks[i].Lines); got != tt.diff {
+			t.Errorf("hunk %d: got lines:\n%s\nwant:\n%s", i, got, tt.diff)
+		}
+	}
+}
+
+func TestUnifiedMergesCloseChanges(t *testing.T) {
+	hunks := Unified(Lines("1\n2\n3\n4\n5", "one\n2\n3\n4\nfive"), 2)
+	if len(hunks) != 1 || hunks[0].Header() != "@@ -1,5 +1,5 @@" {
+		t.Errorf("got hunks %+v; want a single hunk", hunks)
+	}
+}
+
+func TestUnifiedEmptyRanges(t *testing.T) {
+	hunks := Unified(Lines("", "a\nb"), 3)
+	if len(hunks) != 1 || hunks[0].Header() != "@@ -0,0 +1,2 @@" {
+		t.Errorf("got hunks %+v; want @@ -0,0 +1,2 @@", hunks)
+	}
+	if hunks := Unified(Lines("a", "a"), 3); len(hunks) != 0 {
+		t.Errorf("got %d hunks for identical texts; want none", len(hunks))
+	}
+}
+
+// formatRows writes a side-by-side diff with one "left|right" line per row.
+func formatRows(rows []Row) string {
+	var b strings.Builder
+	for _, row := range rows {
+		if row.Left != nil {
+			b.WriteString(row.Left.Text)
+		}
+		b.WriteString("|")
+		if row.Right != nil {
+			b.WriteString(row.Right.Text)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestSideBySide(t *testing.T) {
+	rows := SideBySide(Lines("a\nb\nc\nd", "a\nB\nC\nX\nd\ne"))
+	want := "a|a\nb|B\nc|C\n|X\nd|d\n|e\n"
+	if got := formatRows(rows); got != want {
+		t.Errorf("got rows:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,344 @@
+// Package migrations holds the versioned database schema for every supported
+// SQL backend and a small runner which applies it.
+//
+// Migration files live in one directory per dialect (mysql, postgres, sqlite)
+// and are named like 0001_create_snippets_table.up.sql and
+// 0001_create_snippets_table.down.sql. They are embedded into the binary, and
+// the versions that have been applied are recorded in a schema_migrations table.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// Migration is a single schema version with the SQL to apply and revert it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes a migration and whether it has been applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies the embedded migrations of one dialect to a database.
+type Migrator struct {
+	DB         *sql.DB
+	Dialect    string
+	migrations []Migration
+}
+
+// New returns a Migrator for the given dialect ("mysql", "postgres" or "sqlite").
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	migrations, err := load(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Dialect: dialect, migrations: migrations}, nil
+}
+
+// load reads and pairs up the up/down files of a dialect, sorted by version.
+func load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("migrations: unsupported dialect %q", dialect)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		// file names look like 0001_create_snippets_table.up.sql
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		prefix, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migrations: invalid file name %q", name)
+		}
+
+		body, err := files.ReadFile(path.Join(dialect, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d needs both an up and a down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Latest returns the highest version known to the migrator.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration and returns how many were applied.
+func (m *Migrator) Up() (int, error) {
+	return m.To(m.Latest())
+}
+
+// Down reverts the most recently applied migration. It returns the number of
+// migrations reverted, which is 0 when nothing has been applied yet.
+func (m *Migrator) Down() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) == 0 {
+		return 0, nil
+	}
+
+	// migrate to the highest applied version below the current one
+	current := m.current(applied)
+	target := 0
+	for version := range applied {
+		if version < current && version > target {
+			target = version
+		}
+	}
+	return m.To(target)
+}
+
+// To migrates the database up or down until version is the latest applied
+// migration, and returns how many migrations were applied or reverted.
+func (m *Migrator) To(version int) (int, error) {
+	if version != 0 && !m.known(version) {
+		return 0, fmt.Errorf("migrations: unknown version %d", version)
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	// roll forward through everything pending up to and including version...
+	for _, migration := range m.migrations {
+		if migration.Version > version {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.run(migration, true); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	// ...and roll back, newest first, everything applied above it.
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version <= version {
+			break
+		}
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := m.run(migration, false); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Status lists every known migration together with whether it has been applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// run applies (or reverts) a single migration and updates the bookkeeping
+// table inside the same transaction. Note that MySQL commits DDL statements
+// implicitly, so a failing migration may be left half applied there.
+func (m *Migrator) run(migration Migration, up bool) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	body := migration.Down
+	if up {
+		body = migration.Up
+	}
+	for _, stmt := range splitStatements(body) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("migrations: version %d (%s): %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	if up {
+		_, err = tx.Exec(m.rebind(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`),
+			migration.Version, time.Now().UTC())
+	} else {
+		_, err = tx.Exec(m.rebind(`DELETE FROM schema_migrations WHERE version = ?`), migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applied returns the applied versions and when they were applied, creating
+// the schema_migrations table first if it doesn't exist yet.
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	stmt := `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER NOT NULL PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL
+	)`
+	if _, err := m.DB.Exec(stmt); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// current returns the highest applied version.
+func (m *Migrator) current(applied map[int]time.Time) int {
+	current := 0
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current
+}
+
+func (m *Migrator) known(version int) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// rebind turns ? placeholders into $1, $2, ... for PostgreSQL.
+func (m *Migrator) rebind(query string) string {
+	if m.Dialect != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// splitStatements breaks a migration file into individual statements, since
+// not every driver accepts several statements in a single Exec call.
+// Statements end with a semicolon at the end of a line; semicolons inside a
+// BEGIN ... END block (like a trigger body) don't end the statement.
+func splitStatements(body string) []string {
+	var statements []string
+	var current strings.Builder
+	depth := 0
+
+	for _, line := range strings.Split(body, "\n") {
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		trimmed := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasSuffix(trimmed, "BEGIN"):
+			depth++
+		case strings.HasPrefix(trimmed, "END") && depth > 0:
+			depth--
+		}
+
+		if depth == 0 && strings.HasSuffix(trimmed, ";") {
+			if stmt := strings.TrimSpace(current.String()); stmt != ";" {
+				statements = append(statements, stmt)
+			}
+			current.Reset()
+		}
+	}
+
+	if stmt := strings.TrimSpace(current.String()); stmt != "" {
+		statements = append(statements, stmt)
+	}
+	return statements
+}
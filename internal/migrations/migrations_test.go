@@ -0,0 +1,217 @@
+package migrations
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The migrations run against SQLite everywhere, and against PostgreSQL and
+// MySQL when the DSN of a database they may wipe is set in the same variables
+// as the tests of the models.
+const (
+	testPostgresDSNEnv = "SNIPPETBOX_TEST_POSTGRES_DSN"
+	testMySQLDSNEnv    = "SNIPPETBOX_TEST_MYSQL_DSN"
+)
+
+// forEachDialect runs test as a subtest against an empty database of every
+// dialect available.
+func forEachDialect(t *testing.T, test func(t *testing.T, m *Migrator)) {
+	for _, d := range []struct {
+		dialect, driverName, dsn string
+	}{
+		{"sqlite", "sqlite3", ""},
+		{"postgres", "pgx", os.Getenv(testPostgresDSNEnv)},
+		{"mysql", "mysql", os.Getenv(testMySQLDSNEnv)},
+	} {
+		t.Run(d.dialect, func(t *testing.T) {
+			dsn := d.dsn
+			if d.dialect == "sqlite" {
+				dsn = "file:" + filepath.Join(t.TempDir(), "test.db")
+			}
+			if dsn == "" {
+				t.Skipf("no %s database to test against", d.dialect)
+			}
+
+			db, err := sql.Open(d.driverName, dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m, err := New(db, d.dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				defer db.Close()
+				if _, err := m.To(0); err != nil {
+					t.Error(err)
+				}
+			})
+			test(t, m)
+		})
+	}
+}
+
+// applied returns the versions the status reports as applied, failing the
+// test if any of them lacks the time it was applied at.
+func applied(t *testing.T, m *Migrator) []int {
+	t.Helper()
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != len(m.migrations) {
+		t.Fatalf("got %d statuses; want one for each of the %d migrations", len(statuses), len(m.migrations))
+	}
+	versions := []int{}
+	for _, status := range statuses {
+		if !status.Applied {
+			continue
+		}
+		if status.AppliedAt.IsZero() {
+			t.Errorf("migration %d is applied at no time", status.Version)
+		}
+		versions = append(versions, status.Version)
+	}
+	return versions
+}
+
+// upTo returns the versions from 1 to n.
+func upTo(n int) []int {
+	versions := []int{}
+	for version := 1; version <= n; version++ {
+		versions = append(versions, version)
+	}
+	return versions
+}
+
+func TestLoad(t *testing.T) {
+	var latest int
+	for _, dialect := range []string{"mysql", "postgres", "sqlite"} {
+		migrations, err := load(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Errorf("%s: got version %d in position %d; want the versions numbered from 1", dialect, migration.Version, i)
+			}
+		}
+		if latest == 0 {
+			latest = len(migrations)
+		} else if len(migrations) != latest {
+			t.Errorf("%s: got %d migrations; want %d, as in the other dialects", dialect, len(migrations), latest)
+		}
+	}
+
+	if _, err := New(nil, "oracle"); err == nil {
+		t.Error("got no error for an unsupported dialect")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, m *Migrator) {
+		latest := m.Latest()
+
+		if got := applied(t, m); len(got) != 0 {
+			t.Fatalf("got versions %v applied to an empty database", got)
+		}
+		if n, err := m.Down(); n != 0 || err != nil {
+			t.Errorf("reverted %d migrations with error %v from an empty database; want none", n, err)
+		}
+
+		if n, err := m.Up(); n != latest || err != nil {
+			t.Fatalf("applied %d migrations with error %v; want %d", n, err, latest)
+		}
+		if got := applied(t, m); !reflect.DeepEqual(got, upTo(latest)) {
+			t.Errorf("got versions %v applied; want %v", got, upTo(latest))
+		}
+		if n, err := m.Up(); n != 0 || err != nil {
+			t.Errorf("applied %d migrations with error %v again; want none", n, err)
+		}
+
+		if n, err := m.Down(); n != 1 || err != nil {
+			t.Errorf("reverted %d migrations with error %v; want 1", n, err)
+		}
+		if got := applied(t, m); !reflect.DeepEqual(got, upTo(latest-1)) {
+			t.Errorf("got versions %v applied after down; want %v", got, upTo(latest-1))
+		}
+
+		// every down migration reverts its up migration cleanly enough for
+		// it to be applied again
+		if n, err := m.To(0); n != latest-1 || err != nil {
+			t.Fatalf("reverted %d migrations with error %v; want %d", n, err, latest-1)
+		}
+		if got := applied(t, m); len(got) != 0 {
+			t.Errorf("got versions %v applied after migrating to 0", got)
+		}
+		if n, err := m.To(3); n != 3 || err != nil {
+			t.Errorf("applied %d migrations with error %v; want 3", n, err)
+		}
+		if n, err := m.Up(); n != latest-3 || err != nil {
+			t.Errorf("applied %d migrations with error %v; want %d", n, err, latest-3)
+		}
+
+		if _, err := m.To(latest + 1); err == nil {
+			t.Error("got no error migrating to an unknown version")
+		}
+	})
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "statements",
+			body: "-- a comment\nCREATE TABLE a (id INTEGER);\n\nCREATE INDEX idx ON a (\n    id\n);\n",
+			want: []string{"-- a comment\nCREATE TABLE a (id INTEGER);", "CREATE INDEX idx ON a (\n    id\n);"},
+		},
+		{
+			name: "no final semicolon",
+			body: "DROP TABLE a;\nDROP TABLE b",
+			want: []string{"DROP TABLE a;", "DROP TABLE b"},
+		},
+		{
+			name: "empty statement",
+			body: "DROP TABLE a;\n;\n",
+			want: []string{"DROP TABLE a;"},
+		},
+		{
+			name: "trigger",
+			body: "create trigger t after insert on a begin\n    insert into b values (1);\n    insert into c values (2);\nend;\nDROP TABLE d;",
+			want: []string{"create trigger t after insert on a begin\n    insert into b values (1);\n    insert into c values (2);\nend;", "DROP TABLE d;"},
+		},
+	}
+	for _, tt := range tests {
+		if got := splitStatements(tt.body); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q; want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// the search migration of SQLite creates a table, fills it and keeps it
+	// in sync with four triggers
+	body, err := files.ReadFile("sqlite/0004_add_snippets_search.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := splitStatements(string(body))
+	if len(statements) != 6 {
+		t.Fatalf("got %d statements; want 6: %q", len(statements), statements)
+	}
+	for _, stmt := range statements[2:] {
+		if !strings.HasPrefix(stmt, "CREATE TRIGGER") || !strings.HasSuffix(stmt, "END;") || strings.Count(stmt, ";") != 2 {
+			t.Errorf("got statement %q; want a whole trigger", stmt)
+		}
+	}
+}
@@ -0,0 +1 @@
+CREATE INDEX idx_snippets_expires_id ON snippets (expires, id);
@@ -0,0 +1 @@
+ALTER TABLE snippets ADD FULLTEXT INDEX idx_snippets_fulltext (title, content);
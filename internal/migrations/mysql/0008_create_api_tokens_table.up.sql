@@ -0,0 +1,10 @@
+CREATE TABLE api_tokens (
+    id INTEGER NOT NULL PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(100) NOT NULL,
+    scope VARCHAR(10) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    created DATETIME NOT NULL,
+    last_used DATETIME NULL
+);
+
+ALTER TABLE api_tokens ADD CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash);
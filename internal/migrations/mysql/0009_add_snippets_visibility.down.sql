@@ -0,0 +1,2 @@
+ALTER TABLE snippets DROP COLUMN share_token;
+ALTER TABLE snippets DROP COLUMN visibility;
@@ -0,0 +1,5 @@
+ALTER TABLE snippets ADD COLUMN slug VARCHAR(16) NOT NULL DEFAULT '';
+-- existing snippets get random hex slugs, a subset of the base62 ones the
+-- application generates
+UPDATE snippets SET slug = SUBSTRING(MD5(CONCAT(id, RAND())), 1, 16);
+CREATE UNIQUE INDEX idx_snippets_slug ON snippets (slug);
@@ -0,0 +1 @@
+DROP INDEX idx_snippets_expires_id;
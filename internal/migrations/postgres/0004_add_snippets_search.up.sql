@@ -0,0 +1 @@
+CREATE INDEX idx_snippets_search ON snippets USING GIN (to_tsvector('english', title || ' ' || content));
@@ -0,0 +1,9 @@
+CREATE TABLE snippet_revisions (
+    id SERIAL PRIMARY KEY,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_snippet_revisions_snippet ON snippet_revisions (snippet_id, id);
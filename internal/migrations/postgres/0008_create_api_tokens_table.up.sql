@@ -0,0 +1,9 @@
+CREATE TABLE api_tokens (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    scope VARCHAR(10) NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    created TIMESTAMPTZ NOT NULL,
+    last_used TIMESTAMPTZ NULL,
+    CONSTRAINT api_tokens_uc_token_hash UNIQUE (token_hash)
+);
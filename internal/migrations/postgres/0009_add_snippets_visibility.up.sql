@@ -0,0 +1,2 @@
+ALTER TABLE snippets ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public';
+ALTER TABLE snippets ADD COLUMN share_token VARCHAR(43) NOT NULL DEFAULT '';
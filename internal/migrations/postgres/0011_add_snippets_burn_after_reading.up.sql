@@ -0,0 +1,4 @@
+ALTER TABLE snippets ADD COLUMN burn_after_reading BOOLEAN NOT NULL DEFAULT FALSE;
+-- burned_at is set once a burn after reading snippet has been read, when its
+-- title and content are wiped
+ALTER TABLE snippets ADD COLUMN burned_at TIMESTAMPTZ NULL;
@@ -0,0 +1,2 @@
+-- snippets without a password keep the empty string
+ALTER TABLE snippets ADD COLUMN hashed_password VARCHAR(60) NOT NULL DEFAULT '';
@@ -0,0 +1,21 @@
+-- An external content FTS4 table indexing the title and content of snippets,
+-- kept in sync by the triggers below.
+CREATE VIRTUAL TABLE snippets_fts USING fts4(content="snippets", title, content);
+
+INSERT INTO snippets_fts (snippets_fts) VALUES ('rebuild');
+
+CREATE TRIGGER snippets_fts_before_delete BEFORE DELETE ON snippets BEGIN
+    DELETE FROM snippets_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER snippets_fts_before_update BEFORE UPDATE ON snippets BEGIN
+    DELETE FROM snippets_fts WHERE docid = old.id;
+END;
+
+CREATE TRIGGER snippets_fts_after_update AFTER UPDATE ON snippets BEGIN
+    INSERT INTO snippets_fts (docid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER snippets_fts_after_insert AFTER INSERT ON snippets BEGIN
+    INSERT INTO snippets_fts (docid, title, content) VALUES (new.id, new.title, new.content);
+END;
@@ -0,0 +1 @@
+ALTER TABLE snippets DROP COLUMN manage_key_hash;
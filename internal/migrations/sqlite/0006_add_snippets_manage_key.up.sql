@@ -0,0 +1 @@
+ALTER TABLE snippets ADD COLUMN manage_key_hash CHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+CREATE TABLE snippet_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    snippet_id INTEGER NOT NULL REFERENCES snippets (id) ON DELETE CASCADE,
+    title VARCHAR(100) NOT NULL,
+    content TEXT NOT NULL,
+    created DATETIME NOT NULL
+);
+
+CREATE INDEX idx_snippet_revisions_snippet ON snippet_revisions (snippet_id, id);
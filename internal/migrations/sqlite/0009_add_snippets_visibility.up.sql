@@ -0,0 +1,2 @@
+ALTER TABLE snippets ADD COLUMN visibility VARCHAR(10) NOT NULL DEFAULT 'public';
+ALTER TABLE snippets ADD COLUMN share_token CHAR(43) NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- the content of encrypted snippets is ciphertext, which only the browsers
+-- holding the key in the link can decrypt
+ALTER TABLE snippets ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE snippet_revisions DROP COLUMN key_id;
+ALTER TABLE snippet_revisions DROP COLUMN content_key;
+ALTER TABLE snippets DROP COLUMN key_id;
+ALTER TABLE snippets DROP COLUMN content_key;
@@ -0,0 +1,7 @@
+-- content encrypted at rest holds the data key it was encrypted with in
+-- content_key, itself encrypted with the key-encryption key named by key_id;
+-- rows with an empty key_id hold plain text
+ALTER TABLE snippets ADD COLUMN content_key VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE snippets ADD COLUMN key_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE snippet_revisions ADD COLUMN content_key VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE snippet_revisions ADD COLUMN key_id VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,372 @@
+package models
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Snippet content is encrypted at rest with envelope encryption: every
+// snippet (and revision) gets its own random data key, which encrypts the
+// content with AES-GCM. The data key itself is stored next to the content,
+// encrypted ("wrapped") with a key-encryption key (KEK) from the KeyRing,
+// whose ID is stored alongside so the KEK can be rotated.
+//
+// Rows stored without a KeyRing, or before encryption at rest was enabled,
+// have an empty key ID and hold plain text, until `web rotate-keys`
+// encrypts them.
+
+// keyIDRX matches valid key IDs.
+var keyIDRX = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// kekBytes is the length of key-encryption keys and data keys: 32 bytes
+// select AES-256.
+const kekBytes = 32
+
+// KeyRing holds the key-encryption keys by ID. New content is always
+// encrypted with the current key; the others are only used for decrypting
+// rows which haven't been rotated yet. A nil *KeyRing disables encryption at
+// rest.
+type KeyRing struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// ParseKeyRing reads a key ring from text holding one key per line, as
+// "ID BASE64KEY" (standard base64 of 32 random bytes, as produced by
+// `openssl rand -base64 32`). Entries may also be separated by commas, which
+// is handy for environment variables. The first key is the current one; blank
+// lines and lines starting with # are skipped.
+func ParseKeyRing(text string) (*KeyRing, error) {
+	ring := &KeyRing{keys: map[string]cipher.AEAD{}}
+
+	entries := strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ',' })
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		fields := strings.Fields(entry)
+		if len(fields) != 2 {
+			return nil, errors.New("models: key ring entries must have the form: ID BASE64KEY")
+		}
+		id, encoded := fields[0], fields[1]
+		if !keyIDRX.MatchString(id) {
+			return nil, fmt.Errorf("models: invalid key ID %q", id)
+		}
+		if _, exists := ring.keys[id]; exists {
+			return nil, fmt.Errorf("models: duplicate key ID %q", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != kekBytes {
+			return nil, fmt.Errorf("models: key %q must be %d bytes, base64 encoded", id, kekBytes)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		ring.keys[id] = aead
+		if ring.current == "" {
+			ring.current = id
+		}
+	}
+
+	if ring.current == "" {
+		return nil, errors.New("models: the key ring holds no keys")
+	}
+	return ring, nil
+}
+
+// CurrentID returns the ID of the key new content is encrypted with.
+func (k *KeyRing) CurrentID() string {
+	return k.current
+}
+
+// newAEAD returns AES-GCM with the given key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBytes encrypts plaintext with aead, returning the base64 encoding of the
+// random nonce followed by the ciphertext.
+func sealBytes(aead cipher.AEAD, plaintext []byte, additionalData []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, additionalData)), nil
+}
+
+// openBytes decrypts the output of sealBytes.
+func openBytes(aead cipher.AEAD, sealed string, additionalData []byte) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < aead.NonceSize() {
+		return nil, errors.New("models: ciphertext too short")
+	}
+	return aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], additionalData)
+}
+
+// seal encrypts content under a new data key, returning the encrypted
+// content, the wrapped data key and the ID of the key which wrapped it. With a
+// nil KeyRing, content is returned as is with empty key columns.
+func (k *KeyRing) seal(content string) (string, string, string, error) {
+	if k == nil {
+		return content, "", "", nil
+	}
+
+	dataKey := make([]byte, kekBytes)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", "", "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", "", "", err
+	}
+	sealed, err := sealBytes(aead, []byte(content), nil)
+	if err != nil {
+		return "", "", "", err
+	}
+	// the key ID is authenticated with the wrapped key, so a row can't be
+	// pointed at another key
+	wrapped, err := sealBytes(k.keys[k.current], dataKey, []byte(k.current))
+	if err != nil {
+		return "", "", "", err
+	}
+	return sealed, wrapped, k.current, nil
+}
+
+// open decrypts content sealed with the given wrapped data key and key ID.
+// Content with an empty key ID was stored as plain text and is returned as is.
+func (k *KeyRing) open(content string, contentKey string, keyID string) (string, error) {
+	if keyID == "" {
+		return content, nil
+	}
+	if k == nil {
+		return "", fmt.Errorf("models: content is encrypted with key %q, but no keys are configured", keyID)
+	}
+	kek, ok := k.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("models: content is encrypted with the unknown key %q", keyID)
+	}
+
+	dataKey, err := openBytes(kek, contentKey, []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("models: unwrapping data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openBytes(aead, content, nil)
+	if err != nil {
+		return "", fmt.Errorf("models: decrypting content: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// openSnippet decrypts the content of a scanned snippet in place. It takes
+// the results of a scan function, so it can wrap the call.
+func (k *KeyRing) openSnippet(s *Snippet, err error) (*Snippet, error) {
+	if err != nil {
+		return nil, err
+	}
+	s.Content, err = k.open(s.Content, s.contentKey, s.keyID)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openSnippets decrypts the content of scanned snippets in place, see openSnippet.
+func (k *KeyRing) openSnippets(snippets []*Snippet, err error) ([]*Snippet, error) {
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snippets {
+		if _, err := k.openSnippet(s, nil); err != nil {
+			return nil, err
+		}
+	}
+	return snippets, nil
+}
+
+// openRevision decrypts the content of a scanned revision in place, see openSnippet.
+func (k *KeyRing) openRevision(r *Revision, err error) (*Revision, error) {
+	if err != nil {
+		return nil, err
+	}
+	r.Content, err = k.open(r.Content, r.contentKey, r.keyID)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// openRevisions decrypts the content of scanned revisions in place, see openSnippet.
+func (k *KeyRing) openRevisions(revisions []*Revision, err error) ([]*Revision, error) {
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range revisions {
+		if _, err := k.openRevision(r, nil); err != nil {
+			return nil, err
+		}
+	}
+	return revisions, nil
+}
+
+// openSearchResults decrypts the content of scanned search results in place,
+// see openSnippet.
+func (k *KeyRing) openSearchResults(results []*SearchResult, err error) ([]*SearchResult, error) {
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		if _, err := k.openSnippet(r.Snippet, nil); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// KeyRotator is implemented by the snippet stores which encrypt content at
+// rest. RotateKeys re-encrypts up to batchSize rows which aren't encrypted
+// with the current key yet (including plain text rows), returning how many it
+// re-encrypted; 0 means every row is up to date.
+type KeyRotator interface {
+	RotateKeys(ctx context.Context, batchSize int) (int, error)
+}
+
+// rotationRow is a row (of snippets or snippet_revisions) to be re-encrypted.
+type rotationRow struct {
+	id         int
+	content    string
+	contentKey string
+	keyID      string
+}
+
+// reseal decrypts the content of a row and encrypts it again with the current key.
+func (k *KeyRing) reseal(row *rotationRow) (string, string, string, error) {
+	content, err := k.open(row.content, row.contentKey, row.keyID)
+	if err != nil {
+		return "", "", "", fmt.Errorf("row %d: %w", row.id, err)
+	}
+	return k.seal(content)
+}
+
+// rotateKeys implements KeyRotator for the SQL backends: the rows of snippets
+// are re-encrypted first, then those of snippet_revisions. bind adapts the ?
+// placeholders of the statements to the database, and lock is appended to the
+// SELECT picking the rows of a batch to lock them until they are updated.
+func rotateKeys(ctx context.Context, db *sql.DB, keys *KeyRing, batchSize int, bind func(string) string, lock string) (int, error) {
+	if keys == nil {
+		return 0, errors.New("models: no keys are configured")
+	}
+	for _, table := range []string{"snippets", "snippet_revisions"} {
+		n, err := rotateBatch(ctx, db, keys, table, batchSize, bind, lock)
+		if err != nil || n > 0 {
+			return n, err
+		}
+	}
+	return 0, nil
+}
+
+// rotateBatch re-encrypts a batch of the rows of table in one transaction.
+func rotateBatch(ctx context.Context, db *sql.DB, keys *KeyRing, table string, batchSize int, bind func(string) string, lock string) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := bind(`SELECT id, content, content_key, key_id FROM ` + table + `
+	WHERE key_id <> ? ORDER BY id LIMIT ?` + lock)
+	rows, err := tx.QueryContext(ctx, stmt, keys.CurrentID(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	// read the whole batch before updating, as some drivers can't run another
+	// statement on the connection while rows are open
+	var batch []*rotationRow
+	for rows.Next() {
+		row := &rotationRow{}
+		if err := rows.Scan(&row.id, &row.content, &row.contentKey, &row.keyID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		batch = append(batch, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	stmt = bind(`UPDATE ` + table + ` SET content = ?, content_key = ?, key_id = ? WHERE id = ?`)
+	for _, row := range batch {
+		content, contentKey, keyID, err := keys.reseal(row)
+		if err != nil {
+			return 0, fmt.Errorf("models: %s %w", table, err)
+		}
+		if _, err := tx.ExecContext(ctx, stmt, content, contentKey, keyID, row.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), tx.Commit()
+}
+
+// decryptedSearchRows is the number of snippets searchDecrypted looks at,
+// the newest ones: decrypting them all on every search doesn't scale.
+const decryptedSearchRows = 1000
+
+// searchDecrypted implements Search for the SQL backends when content is
+// encrypted at rest: the full-text indexes only ever see ciphertext, so the
+// candidate snippets selected by stmt are decrypted and ranked in Go instead,
+// one row at a time. stmt takes the number of rows to select as its only
+// argument, and should select the newest snippets first. Search degrades
+// with encryption on: it is slower, and only finds snippets among the newest
+// decryptedSearchRows unexpired public ones.
+func searchDecrypted(ctx context.Context, db *sql.DB, keys *KeyRing, stmt string, terms []string, limit int) ([]*SearchResult, error) {
+	rows, err := db.QueryContext(ctx, stmt, decryptedSearchRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		s := &Snippet{}
+		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility, &s.Slug, &s.contentKey, &s.keyID)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := keys.openSnippet(s, nil); err != nil {
+			return nil, err
+		}
+		// only the matches are kept, not every decrypted snippet
+		if rank := rankSnippet(s, terms); rank > 0 {
+			results = append(results, &SearchResult{Snippet: s, Rank: rank})
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortResults(results, limit), nil
+}
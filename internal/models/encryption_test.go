@@ -0,0 +1,201 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestKey returns a random key-encryption key, base64 encoded.
+func newTestKey(t *testing.T) string {
+	t.Helper()
+
+	key := make([]byte, kekBytes)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// parseTestKeyRing parses text as a key ring, failing the test on errors.
+func parseTestKeyRing(t *testing.T, text string) *KeyRing {
+	t.Helper()
+
+	keys, err := ParseKeyRing(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// newTestKeyRing returns a key ring holding a single random key.
+func newTestKeyRing(t *testing.T) *KeyRing {
+	t.Helper()
+	return parseTestKeyRing(t, "test "+newTestKey(t))
+}
+
+func TestSealedContentFitsText(t *testing.T) {
+	sealed, _, _, err := newTestKeyRing(t).seal(strings.Repeat("x", MaxContentBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sealed) > 65535 {
+		t.Errorf("got %d bytes of sealed content; want at most 65535", len(sealed))
+	}
+}
+
+func TestSearchDecrypted(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000"
+	snippets := &SQLiteSnippetModel{DB: newTestDB(t, "sqlite3", dsn, "sqlite"), Keys: newTestKeyRing(t)}
+
+	ctx := context.Background()
+	for _, content := range []string{"An old silent pond", "A frog jumps into the pond", "Splash! Silence again."} {
+		if _, _, err := snippets.Insert(ctx, "Haiku", content, 7, VisibilityPublic, false, "", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := snippets.Search(ctx, "pond", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results; want 2", len(results))
+	}
+	for _, result := range results {
+		if !strings.Contains(result.Content, "pond") {
+			t.Errorf("got content %q; want it decrypted and matching", result.Content)
+		}
+	}
+}
+
+// setKeys sets the key ring of the SQL snippet stores.
+func setKeys(t *testing.T, snippets SnippetStore, keys *KeyRing) {
+	t.Helper()
+
+	switch m := snippets.(type) {
+	case *SQLiteSnippetModel:
+		m.Keys = keys
+	case *PostgresSnippetModel:
+		m.Keys = keys
+	case *SnippetModel:
+		m.Keys = keys
+	default:
+		t.Skip("the store keeps nothing at rest")
+	}
+}
+
+// keyIDs returns how many rows of snippets and snippet_revisions are stored
+// under each key ID, "" for plain text, and fails the test if the content of
+// a row encrypted under a key is plain text.
+func keyIDs(t *testing.T, stores testStores, plainText string) map[string]int {
+	t.Helper()
+
+	counts := map[string]int{}
+	for _, table := range []string{"snippets", "snippet_revisions"} {
+		rows, err := stores.DB.Query("SELECT key_id, content FROM " + table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var keyID, content string
+			if err := rows.Scan(&keyID, &content); err != nil {
+				t.Fatal(err)
+			}
+			if keyID != "" && strings.Contains(content, plainText) {
+				t.Errorf("%s row under key %q holds plain text", table, keyID)
+			}
+			counts[keyID]++
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return counts
+}
+
+// rotateAll rotates the keys of every row, batchSize at a time, and returns
+// how many rows were re-encrypted.
+func rotateAll(t *testing.T, snippets SnippetStore, batchSize int) int {
+	t.Helper()
+
+	total := 0
+	for {
+		n, err := snippets.(KeyRotator).RotateKeys(context.Background(), batchSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			return total
+		}
+		total += n
+	}
+}
+
+func TestSnippetStoreRotateKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		ctx := context.Background()
+		snippets := stores.Snippets
+		setKeys(t, snippets, nil)
+
+		// two snippets and a revision stored as plain text, before encryption
+		// at rest was enabled
+		id, _, err := snippets.Insert(ctx, "Haiku", "Secret: an old silent pond", 7, VisibilityPublic, false, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := snippets.Update(ctx, id, "Haiku", "Secret: a frog jumps into the pond"); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := snippets.Insert(ctx, "Haiku", "Secret: splash! Silence again", 7, VisibilityPublic, false, "", false); err != nil {
+			t.Fatal(err)
+		}
+		if got := keyIDs(t, stores, "Secret"); got[""] != 3 {
+			t.Fatalf("got rows by key %v; want 3 plain text rows", got)
+		}
+
+		check := func() {
+			t.Helper()
+			snippet, err := snippets.Get(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			revisions, err := snippets.Revisions(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snippet.Content != "Secret: a frog jumps into the pond" || len(revisions) != 1 || revisions[0].Content != "Secret: an old silent pond" {
+				t.Errorf("got content %q and revisions %+v; want them decrypted", snippet.Content, revisions)
+			}
+		}
+
+		// the plain text rows are encrypted, revisions included
+		oldKey := newTestKey(t)
+		setKeys(t, snippets, parseTestKeyRing(t, "old "+oldKey))
+		if n := rotateAll(t, snippets, 2); n != 3 {
+			t.Errorf("rotated %d rows; want 3", n)
+		}
+		if got := keyIDs(t, stores, "Secret"); got["old"] != 3 {
+			t.Errorf("got rows by key %v; want 3 rows under the old key", got)
+		}
+		check()
+
+		// then re-encrypted under a new key, the old one still reading the
+		// rows which haven't been rotated yet
+		newKey := newTestKey(t)
+		setKeys(t, snippets, parseTestKeyRing(t, "new "+newKey+"\nold "+oldKey))
+		check()
+		if n := rotateAll(t, snippets, 1); n != 3 {
+			t.Errorf("rotated %d rows; want 3", n)
+		}
+		if got := keyIDs(t, stores, "Secret"); got["new"] != 3 {
+			t.Errorf("got rows by key %v; want 3 rows under the new key", got)
+		}
+		// after which the old key can go
+		setKeys(t, snippets, parseTestKeyRing(t, "new "+newKey))
+		check()
+	})
+}
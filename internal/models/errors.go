@@ -3,3 +3,14 @@ package models
 import "errors"
 
 var ErrNoRecord = errors.New("models: no matching record found")
+
+// ErrInvalidCredentials is returned when a user tries to login with an
+// incorrect email address or password.
+var ErrInvalidCredentials = errors.New("models: invalid credentials")
+
+// ErrDuplicateEmail is returned when a user tries to signup with an email
+// address that's already in use.
+var ErrDuplicateEmail = errors.New("models: duplicate email")
+
+// ErrInvalidToken is returned when an API token is unknown or has been revoked.
+var ErrInvalidToken = errors.New("models: invalid API token")
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// newManageKey generates a random management key for a snippet, returning
+// the key to hand to its creator and the hash of it to store.
+func newManageKey() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key := base64.RawURLEncoding.EncodeToString(b)
+	return key, hashManageKey(key), nil
+}
+
+// slugAlphabet holds the characters of snippet slugs (base62).
+const slugAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// slugLength is the number of characters of a new slug. 62^10 possible slugs
+// (almost 60 bits) make them impractical to guess.
+const slugLength = 10
+
+// slugAttempts is how many random slugs Insert tries before giving up, should
+// the slugs it generates already be taken.
+const slugAttempts = 5
+
+// newSlug generates a random base62 slug for a snippet.
+func newSlug() (string, error) {
+	slug := make([]byte, 0, slugLength)
+	b := make([]byte, slugLength*2)
+	for len(slug) < slugLength {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		for _, c := range b {
+			// skip the bytes beyond the largest multiple of 62, which would
+			// otherwise make the first characters of the alphabet more likely
+			if c >= 248 || len(slug) == slugLength {
+				continue
+			}
+			slug = append(slug, slugAlphabet[c%62])
+		}
+	}
+	return string(slug), nil
+}
+
+// hashManageKey returns the hex encoded SHA-256 hash of a management key. The
+// keys are long and random, so a fast hash is enough to protect them at rest.
+func hashManageKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// manageKeyMatches reports, in constant time, whether key hashes to hash.
+// Snippets created before management keys existed have an empty hash, which
+// never matches.
+func manageKeyMatches(hash string, key string) bool {
+	if hash == "" || key == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashManageKey(key))) == 1
+}
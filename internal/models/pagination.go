@@ -0,0 +1,163 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("models: invalid pagination cursor")
+
+// SnippetSort is the order in which List returns snippets.
+type SnippetSort string
+
+const (
+	SortNewest   SnippetSort = "newest"
+	SortOldest   SnippetSort = "oldest"
+	SortExpiring SnippetSort = "expiring"
+)
+
+// ParseSnippetSort returns the SnippetSort for value, defaulting to SortNewest
+// when value is empty. ok is false if value isn't a known sort order.
+func ParseSnippetSort(value string) (SnippetSort, bool) {
+	switch SnippetSort(value) {
+	case "", SortNewest:
+		return SortNewest, true
+	case SortOldest, SortExpiring:
+		return SnippetSort(value), true
+	}
+	return SortNewest, false
+}
+
+// SnippetPage is one page of a keyset paginated listing. Next and Prev are
+// opaque cursors for the neighbouring pages, empty when there is no such page.
+type SnippetPage struct {
+	Snippets []*Snippet
+	Next     string
+	Prev     string
+}
+
+// cursor marks a position in a listing: the sort key of a snippet plus whether
+// the page wanted lies after or before it.
+type cursor struct {
+	Before  bool
+	ID      int
+	Expires time.Time
+}
+
+func (c cursor) encode() string {
+	direction := "a"
+	if c.Before {
+		direction = "b"
+	}
+	raw := fmt.Sprintf("%s.%d.%d", direction, c.ID, c.Expires.UnixNano())
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(value string) (*cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != 3 || (parts[0] != "a" && parts[0] != "b") {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor{Before: parts[0] == "b", ID: id, Expires: time.Unix(0, nanos).UTC()}, nil
+}
+
+// keyset builds the SQL shared by the SQL backends for one page of a listing:
+// the condition that skips everything up to the cursor (empty without one),
+// its arguments, and the ORDER BY clause. When the cursor points backwards the
+// order is reversed, so the rows have to be flipped again by newPage. The SQL
+// uses ? placeholders; backends needing other placeholders rebind it.
+func keyset(sort SnippetSort, c *cursor) (string, []any, string) {
+	before := c != nil && c.Before
+
+	switch sort {
+	case SortOldest:
+		order := "id ASC"
+		if before {
+			order = "id DESC"
+		}
+		if c == nil {
+			return "", nil, order
+		}
+		if before {
+			return "id < ?", []any{c.ID}, order
+		}
+		return "id > ?", []any{c.ID}, order
+	case SortExpiring:
+		order := "expires ASC, id ASC"
+		if before {
+			order = "expires DESC, id DESC"
+		}
+		if c == nil {
+			return "", nil, order
+		}
+		if before {
+			return "(expires < ? OR (expires = ? AND id < ?))", []any{c.Expires, c.Expires, c.ID}, order
+		}
+		return "(expires > ? OR (expires = ? AND id > ?))", []any{c.Expires, c.Expires, c.ID}, order
+	default:
+		order := "id DESC"
+		if before {
+			order = "id ASC"
+		}
+		if c == nil {
+			return "", nil, order
+		}
+		if before {
+			return "id > ?", []any{c.ID}, order
+		}
+		return "id < ?", []any{c.ID}, order
+	}
+}
+
+// newPage turns up to limit+1 rows fetched in keyset order into a SnippetPage,
+// putting them back in display order and working out the neighbouring cursors.
+func newPage(snippets []*Snippet, c *cursor, limit int) *SnippetPage {
+	hasMore := len(snippets) > limit
+	if hasMore {
+		snippets = snippets[:limit]
+	}
+
+	before := c != nil && c.Before
+	if before {
+		for i, j := 0, len(snippets)-1; i < j; i, j = i+1, j-1 {
+			snippets[i], snippets[j] = snippets[j], snippets[i]
+		}
+	}
+
+	page := &SnippetPage{Snippets: snippets}
+	if len(snippets) == 0 {
+		return page
+	}
+
+	first, last := snippets[0], snippets[len(snippets)-1]
+	// Going forwards there is a previous page whenever we started from a
+	// cursor, and a next page if more rows came back than were asked for.
+	// Going backwards it's the other way around.
+	if (!before && hasMore) || before {
+		page.Next = cursor{ID: last.ID, Expires: last.Expires}.encode()
+	}
+	if (before && hasMore) || (!before && c != nil) {
+		page.Prev = cursor{Before: true, ID: first.ID, Expires: first.Expires}.encode()
+	}
+	return page
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, c := range []cursor{{ID: 7, Expires: expires}, {Before: true, ID: 1, Expires: expires}} {
+		got, err := decodeCursor(c.encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != c {
+			t.Errorf("got cursor %+v; want %+v", *got, c)
+		}
+	}
+
+	if c, err := decodeCursor(""); c != nil || err != nil {
+		t.Errorf("got cursor %v and error %v for no cursor; want neither", c, err)
+	}
+
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	for _, value := range []string{"!!!", encode("a.1"), encode("c.1.0"), encode("a.one.0"), encode("b.1.soon")} {
+		if _, err := decodeCursor(value); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("got error %v for cursor %q; want ErrInvalidCursor", err, value)
+		}
+	}
+}
+
+// listIDs pages through the listing in the given order, limit snippets at a
+// time, first forwards then back from the last page, and returns the IDs seen
+// each way, in display order.
+func listIDs(t *testing.T, snippets SnippetStore, sort SnippetSort, limit int) ([]int, []int) {
+	t.Helper()
+
+	ids := func(page *SnippetPage) []int {
+		ids := make([]int, len(page.Snippets))
+		for i, s := range page.Snippets {
+			ids[i] = s.ID
+		}
+		return ids
+	}
+
+	page, err := snippets.List(context.Background(), sort, "", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Prev != "" {
+		t.Error("the first page has a previous page")
+	}
+	forwards := ids(page)
+	for page.Next != "" {
+		page, err = snippets.List(context.Background(), sort, page.Next, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		forwards = append(forwards, ids(page)...)
+	}
+
+	backwards := ids(page)
+	for page.Prev != "" {
+		page, err = snippets.List(context.Background(), sort, page.Prev, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backwards = append(ids(page), backwards...)
+	}
+	return forwards, backwards
+}
+
+func TestSnippetStoreList(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		ctx := context.Background()
+		insert := func(visibility Visibility) int {
+			id, _, err := stores.Snippets.Insert(ctx, "Title", "Content", 7, visibility, false, "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return id
+		}
+
+		ids := make([]int, 6)
+		for i := range ids {
+			ids[i] = insert(VisibilityPublic)
+		}
+		// neither of these is listed
+		stores.setExpires(t, insert(VisibilityPublic), time.Now().Add(-time.Hour))
+		insert(VisibilityPrivate)
+
+		// the first, second and fourth snippets expire at the same time, so
+		// the expiring order falls back on their IDs
+		soon := time.Now().Add(24 * time.Hour)
+		for i, expires := range []time.Time{soon, soon, soon.Add(time.Hour), soon, soon.Add(-time.Hour), soon.Add(2 * time.Hour)} {
+			stores.setExpires(t, ids[i], expires)
+		}
+
+		tests := []struct {
+			sort SnippetSort
+			want []int
+		}{
+			{SortNewest, []int{ids[5], ids[4], ids[3], ids[2], ids[1], ids[0]}},
+			{SortOldest, ids},
+			{SortExpiring, []int{ids[4], ids[0], ids[1], ids[3], ids[2], ids[5]}},
+		}
+		for _, tt := range tests {
+			for _, limit := range []int{1, 2, 4, 6, 10} {
+				forwards, backwards := listIDs(t, stores.Snippets, tt.sort, limit)
+				if !reflect.DeepEqual(forwards, tt.want) {
+					t.Errorf("%s by %d: got %v going forwards; want %v", tt.sort, limit, forwards, tt.want)
+				}
+				if !reflect.DeepEqual(backwards, tt.want) {
+					t.Errorf("%s by %d: got %v going backwards; want %v", tt.sort, limit, backwards, tt.want)
+				}
+			}
+		}
+
+		if _, err := stores.Snippets.List(ctx, SortNewest, "not a cursor", 2); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("got error %v for an invalid cursor; want ErrInvalidCursor", err)
+		}
+	})
+}
+
+func TestSnippetStoreListEmpty(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		page, err := stores.Snippets.List(context.Background(), SortNewest, "", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Snippets) != 0 || page.Next != "" || page.Prev != "" {
+			t.Errorf("got page %+v; want an empty one", page)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Revision holds an earlier version of a snippet: the title and content it had
+// before the edit made at Created.
+type Revision struct {
+	ID        int
+	SnippetID int
+	Title     string
+	Content   string
+	Created   time.Time
+	// contentKey and keyID say how the content is encrypted at rest, see Snippet.
+	contentKey string
+	keyID      string
+}
+
+// Revisions returns the revisions of a snippet, most recent first.
+func (m *SnippetModel) Revisions(ctx context.Context, id int) ([]*Revision, error) {
+	stmt := `SELECT id, snippet_id, title, content, created, content_key, key_id FROM snippet_revisions
+	WHERE snippet_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.Keys.openRevisions(scanRevisions(rows))
+}
+
+// GetRevision returns a single revision of a snippet.
+func (m *SnippetModel) GetRevision(ctx context.Context, id int, revisionID int) (*Revision, error) {
+	stmt := `SELECT id, snippet_id, title, content, created, content_key, key_id FROM snippet_revisions
+	WHERE snippet_id = ? AND id = ?`
+	return m.Keys.openRevision(scanRevision(m.DB.QueryRowContext(ctx, stmt, id, revisionID)))
+}
+
+// scanRevisions reads every row of a snippet_revisions query (id, snippet_id,
+// title, content, created) and closes the resultSet.
+func scanRevisions(rows *sql.Rows) ([]*Revision, error) {
+	defer rows.Close()
+
+	var revisions []*Revision
+	for rows.Next() {
+		r := &Revision{}
+		err := rows.Scan(&r.ID, &r.SnippetID, &r.Title, &r.Content, &r.Created, &r.contentKey, &r.keyID)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// scanRevision reads a single snippet_revisions row.
+func scanRevision(row *sql.Row) (*Revision, error) {
+	r := &Revision{}
+	err := row.Scan(&r.ID, &r.SnippetID, &r.Title, &r.Content, &r.Created, &r.contentKey, &r.keyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return r, nil
+}
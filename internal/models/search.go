@@ -0,0 +1,104 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchResult is a snippet matching a search query together with its
+// relevance; results with a higher Rank match the query better.
+type SearchResult struct {
+	*Snippet
+	Rank float64
+}
+
+// SearchTerms splits a search query into its distinct, lower cased words.
+// Punctuation is dropped, so the terms are safe to pass on to any full-text
+// query syntax.
+func SearchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	seen := map[string]bool{}
+	var terms []string
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// titleWeight is how much more a term found in the title counts towards the
+// rank than the same term found in the content.
+const titleWeight = 3
+
+// rankSnippet scores a snippet against the search terms for the backends
+// without built-in ranking. It returns 0 unless every term occurs in the title
+// or the content.
+func rankSnippet(s *Snippet, terms []string) float64 {
+	title, content := strings.ToLower(s.Title), strings.ToLower(s.Content)
+
+	var rank float64
+	for _, term := range terms {
+		hits := titleWeight*strings.Count(title, term) + strings.Count(content, term)
+		if hits == 0 {
+			return 0
+		}
+		rank += float64(hits)
+	}
+	return rank
+}
+
+// sortResults orders search results by rank, breaking ties with the newest
+// snippet first, and keeps at most limit of them.
+func sortResults(results []*SearchResult, limit int) []*SearchResult {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].ID > results[j].ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// rankSnippets ranks snippets against the search terms in Go, keeping up to
+// limit of the ones matching every term, best match first.
+func rankSnippets(snippets []*Snippet, terms []string, limit int) []*SearchResult {
+	var results []*SearchResult
+	for _, s := range snippets {
+		if rank := rankSnippet(s, terms); rank > 0 {
+			results = append(results, &SearchResult{Snippet: s, Rank: rank})
+		}
+	}
+	return sortResults(results, limit)
+}
+
+// scanSearchResults reads every row of a search query (id, title, content,
+// created, expires, visibility, slug, content_key, key_id, rank) and closes the
+// resultSet.
+func scanSearchResults(rows *sql.Rows) ([]*SearchResult, error) {
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		r := &SearchResult{Snippet: &Snippet{}}
+		err := rows.Scan(&r.ID, &r.Title, &r.Content, &r.Created, &r.Expires, &r.Visibility, &r.Slug, &r.contentKey, &r.keyID, &r.Rank)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -1,45 +1,175 @@
 package models
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"errors"
-	"fmt"
+	"strings"
 	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// MaxContentBytes is the length limit of snippet content. Encrypted at rest,
+// content grows by a third (base64 of the content and the AES-GCM nonce and
+// tag), and 48000 bytes still fit the 65535 bytes of the TEXT column of MySQL
+// once sealed.
+const MaxContentBytes = 48000
+
 // Snippet type is defined to hold the data for an individual snippet. Notice how
 // the fields of the struct correspond to the fields in our MySQL snippets table?
+// The json tags name the fields in the responses of the JSON API.
 type Snippet struct {
-	ID      int
-	Title   string // replace with sql.NullString if column in DB can be nullable
-	Content string // replace with sql.NullString if column in DB can be nullable
-	Created time.Time
-	Expires time.Time
+	ID         int        `json:"id"`
+	Slug       string     `json:"slug"`
+	Title      string     `json:"title"`   // replace with sql.NullString if column in DB can be nullable
+	Content    string     `json:"content"` // replace with sql.NullString if column in DB can be nullable
+	Created    time.Time  `json:"created"`
+	Expires    time.Time  `json:"expires"`
+	Visibility Visibility `json:"visibility"`
+	// ShareToken is the secret part of the /snippet/view/{id}?share= links
+	// handed out for unlisted snippets before they had slugs, which keep
+	// working. New snippets don't get one. It is only loaded for single snippets.
+	ShareToken string `json:"-"`
+	// BurnAfterReading snippets are wiped the first time they are read (see
+	// SnippetStore.Burn). BurnedAt is when that happened, the zero time until then.
+	BurnAfterReading bool      `json:"burn_after_reading"`
+	BurnedAt         time.Time `json:"-"`
+	// HashedPassword is the bcrypt hash of the password protecting the
+	// snippet, empty when it has none.
+	HashedPassword []byte `json:"-"`
+	// Encrypted snippets hold content encrypted in the browser, with a key the
+	// server never sees. Their content is ciphertext, which is never searched,
+	// diffed or otherwise interpreted.
+	Encrypted bool `json:"encrypted"`
+	// contentKey is the wrapped data key the content is encrypted with at rest,
+	// and keyID the ID of the key-encryption key which wrapped it (see
+	// KeyRing). Both are empty for content stored as plain text.
+	contentKey string
+	keyID      string
+}
+
+// Burned reports whether the snippet burned after reading, leaving only its
+// tombstone: the snippet without title and content.
+func (s *Snippet) Burned() bool {
+	return !s.BurnedAt.IsZero()
+}
+
+// PasswordProtected reports whether the snippet can only be read after its
+// password has been given.
+func (s *Snippet) PasswordProtected() bool {
+	return len(s.HashedPassword) > 0
+}
+
+// PasswordMatches reports whether password is the password of the snippet.
+// Snippets without a password never match.
+func (s *Snippet) PasswordMatches(password string) bool {
+	if !s.PasswordProtected() {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword(s.HashedPassword, []byte(password)) == nil
+}
+
+// hashSnippetPassword returns the bcrypt hash to store for the password of a
+// new snippet, or "" when it has no password.
+func hashSnippetPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// Visibility controls who can find and view a snippet.
+type Visibility string
+
+const (
+	// VisibilityPublic snippets are listed and searchable.
+	VisibilityPublic Visibility = "public"
+	// VisibilityUnlisted snippets are left out of listings and search, but
+	// anyone with their link (which holds the slug) can view them.
+	VisibilityUnlisted Visibility = "unlisted"
+	// VisibilityPrivate snippets can only be viewed by their owner.
+	VisibilityPrivate Visibility = "private"
+)
+
+// ParseVisibility returns the Visibility named by value, defaulting to
+// VisibilityPublic when value is empty. ok is false if value isn't a known
+// visibility.
+func ParseVisibility(value string) (Visibility, bool) {
+	switch Visibility(value) {
+	case "":
+		return VisibilityPublic, true
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return Visibility(value), true
+	}
+	return VisibilityPublic, false
+}
+
+// ShareTokenMatches reports, in constant time, whether token is the share
+// token of the snippet. Snippets without a share token never match.
+func (s *Snippet) ShareTokenMatches(token string) bool {
+	if s.ShareToken == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(s.ShareToken), []byte(token)) == 1
+}
+
+// SnippetStore describes the snippet operations the web application relies on.
+// Handlers only talk to this interface, so any storage backend (MySQL, the
+// in-memory store, ...) can be plugged into config.Application.
+type SnippetStore interface {
+	Get(ctx context.Context, id int) (*Snippet, error)
+	GetBySlug(ctx context.Context, slug string) (*Snippet, error)
+	Insert(ctx context.Context, title string, content string, expires int, visibility Visibility, burnAfterReading bool, password string, encrypted bool) (int, string, error)
+	Burn(ctx context.Context, slug string) (*Snippet, error)
+	Latest(ctx context.Context) ([]*Snippet, error)
+	List(ctx context.Context, sort SnippetSort, cursor string, limit int) (*SnippetPage, error)
+	Search(ctx context.Context, query string, limit int) ([]*SearchResult, error)
+	CheckManageKey(ctx context.Context, id int, key string) (bool, error)
+	Update(ctx context.Context, id int, title string, content string) error
+	Delete(ctx context.Context, id int) error
+	Revisions(ctx context.Context, id int) ([]*Revision, error)
+	GetRevision(ctx context.Context, id int, revisionID int) (*Revision, error)
+	PurgeExpired(ctx context.Context, before time.Time, batchSize int) (int, error)
 }
 
 // SnippetModel type is defined which wraps a sql.DB connection pool
+// and implements SnippetStore on top of MySQL.
 type SnippetModel struct {
 	DB *sql.DB
+	// Keys encrypts the content of snippets and revisions at rest; when nil,
+	// content is stored as plain text.
+	Keys *KeyRing
 }
 
-func (m *SnippetModel) Get(id int) (*Snippet, error) {
+func (m *SnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
 	// Write the SQL statement we want to execute.
-	stmt := `SELECT id, title, content, created, expires FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, share_token, burn_after_reading, burned_at, hashed_password, encrypted, content_key, key_id FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND id = ?`
 	// Use the QueryRow() method on the connection pool to execute our
 	// SQL statement, passing in the untrusted id variable as the value for the
 	// placeholder parameter. This returns a pointer to a sql.Row object which
 	// holds the result from the database.
-	row := m.DB.QueryRow(stmt, id)
+	row := m.DB.QueryRowContext(ctx, stmt, id)
 
 	// Initialize a pointer to a new zeroed Snippet struct.
 	s := &Snippet{}
+	// burned_at can be NULL, so it is scanned into a sql.NullTime first.
+	var burnedAt sql.NullTime
 
 	// Use row.Scan() to copy the values from each field in sql.Row to the
 	// corresponding field in the Snippet struct. Notice that the arguments
 	// to row.Scan are *pointers* to the place you want to copy the data into,
 	// and the number of arguments must be exactly the same as the number of
 	// columns returned by your statement.
-	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility, &s.Slug, &s.ShareToken,
+		&s.BurnAfterReading, &burnedAt, &s.HashedPassword, &s.Encrypted, &s.contentKey, &s.keyID)
 	if err != nil {
 		// If the query returns no rows, then row.Scan() will return a
 		// sql.ErrNoRows error. We use the errors.Is() function check for that
@@ -51,38 +181,80 @@ func (m *SnippetModel) Get(id int) (*Snippet, error) {
 			return nil, err
 		}
 	}
-	return s, nil
+	s.BurnedAt = burnedAt.Time
+	return m.Keys.openSnippet(s, nil)
 }
 
-// Insert a new snippet into the database.
-func (m *SnippetModel) Insert(title string, content string, expires int) (int, error) {
-	stmt := `INSERT INTO snippets (title, content, created, expires)
-	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY))`
-
-	result, err := m.DB.Exec(stmt, title, content, expires)
+// GetBySlug returns the unexpired snippet with the given slug.
+func (m *SnippetModel) GetBySlug(ctx context.Context, slug string) (*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, share_token, burn_after_reading, burned_at, hashed_password, encrypted, content_key, key_id FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND slug = ?`
+	return m.Keys.openSnippet(scanSnippet(m.DB.QueryRowContext(ctx, stmt, slug)))
+}
 
+// Insert a new snippet into the database, protected by password unless it is
+// empty. Alongside the new snippet's ID it returns a random management key which authorizes editing and deleting the
+// snippet later on. Only a hash of the key is stored, so this is the one and
+// only time the plain key is available. The snippet gets a random slug; should
+// it be taken already, the insert is retried with another one.
+func (m *SnippetModel) Insert(ctx context.Context, title string, content string, expires int, visibility Visibility, burnAfterReading bool, password string, encrypted bool) (int, string, error) {
+	key, keyHash, err := newManageKey()
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
-
-	id, err := result.LastInsertId()
+	hashedPassword, err := hashSnippetPassword(password)
 	if err != nil {
-		return 0, err
+		return 0, "", err
 	}
+	content, contentKey, keyID, err := m.Keys.seal(content)
+	if err != nil {
+		return 0, "", err
+	}
+
+	stmt := `INSERT INTO snippets (title, content, created, expires, manage_key_hash, visibility, slug, burn_after_reading, hashed_password, encrypted, content_key, key_id)
+	VALUES(?, ?, UTC_TIMESTAMP(), DATE_ADD(UTC_TIMESTAMP(), INTERVAL ? DAY), ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	return int(id), nil
+	for attempt := 1; ; attempt++ {
+		slug, err := newSlug()
+		if err != nil {
+			return 0, "", err
+		}
+
+		result, err := m.DB.ExecContext(ctx, stmt, title, content, expires, keyHash, string(visibility), slug, burnAfterReading, hashedPassword, encrypted, contentKey, keyID)
+		if err != nil {
+			if attempt < slugAttempts && isDuplicateSlugMySQL(err) {
+				continue
+			}
+			return 0, "", err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, "", err
+		}
+
+		return int(id), key, nil
+	}
+}
+
+// isDuplicateSlugMySQL reports whether err is the violation of the unique
+// index on the slug column.
+func isDuplicateSlugMySQL(err error) bool {
+	var mySQLError *mysql.MySQLError
+	return errors.As(err, &mySQLError) && mySQLError.Number == 1062 &&
+		strings.Contains(mySQLError.Message, "idx_snippets_slug")
 }
 
 // Latest will return the 10 most recently created  snippets
-func (m *SnippetModel) Latest() ([]*Snippet, error) {
+func (m *SnippetModel) Latest(ctx context.Context) ([]*Snippet, error) {
 	// the SQL statement we want to execute
-	stmt := `SELECT id, title, content, created, expires FROM snippets
-			WHERE expires > UTC_TIMESTAMP() ORDER BY id DESC LIMIT 10`
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id FROM snippets
+			WHERE expires > UTC_TIMESTAMP() AND visibility = 'public' ORDER BY id DESC LIMIT 10`
 
 	// Use the Query() method on the connection pool to execute our
 	// SQL statement. This returns a sql.Rows resultSet containing the result
 	// of our query.
-	rows, err := m.DB.Query(stmt)
+	rows, err := m.DB.QueryContext(ctx, stmt)
 	if err != nil {
 		return nil, err
 	}
@@ -106,14 +278,13 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	for rows.Next() {
 		// Create a pointer to a new zeroed Snippet struct.
 		s := &Snippet{}
-		fmt.Println(s.Created)
 		// Use rows.Scan() to copy the values from each field in the row to
 		// new Snippet object that we created. Again, the arguments to row.Scan() the
 		// must be pointers to the place you want to copy the data into, and
 		// number of arguments must be exactly the same as the number of
 		// columns returned by your statement.
 
-		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires)
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility, &s.Slug, &s.contentKey, &s.keyID)
 		if err != nil {
 			return nil, err
 		}
@@ -127,5 +298,235 @@ func (m *SnippetModel) Latest() ([]*Snippet, error) {
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+	return m.Keys.openSnippets(snippets, nil)
+}
+
+// List returns one page of unexpired public snippets in the given sort order,
+// starting from a cursor previously handed out in a SnippetPage (or from the
+// beginning when cursor is empty). Paging is keyset based, so it stays fast no
+// matter how deep into the table the page is.
+func (m *SnippetModel) List(ctx context.Context, sort SnippetSort, cursor string, limit int) (*SnippetPage, error) {
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	condition, args, order := keyset(sort, c)
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND visibility = 'public'`
+	if condition != "" {
+		stmt += " AND " + condition
+	}
+	// fetch one extra row to find out whether there is another page
+	stmt += " ORDER BY " + order + " LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := m.Keys.openSnippets(scanSnippets(rows))
+	if err != nil {
+		return nil, err
+	}
+	return newPage(snippets, c, limit), nil
+}
+
+// Search returns up to limit unexpired public snippets matching query, best match
+// first, using the FULLTEXT index over the title and content columns. Encrypted
+// snippets are left out, as their content is ciphertext. With content
+// encrypted at rest the index is of no use, see searchDecrypted.
+func (m *SnippetModel) Search(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	if m.Keys != nil {
+		stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id FROM snippets
+		WHERE expires > UTC_TIMESTAMP() AND visibility = 'public' AND NOT encrypted
+		ORDER BY id DESC LIMIT ?`
+		return searchDecrypted(ctx, m.DB, m.Keys, stmt, terms, limit)
+	}
+
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id, MATCH(title, content) AGAINST(?) AS score
+	FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND visibility = 'public' AND NOT encrypted
+	AND MATCH(title, content) AGAINST(?)
+	ORDER BY score DESC, id DESC LIMIT ?`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, query, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return m.Keys.openSearchResults(scanSearchResults(rows))
+}
+
+// CheckManageKey reports whether key is the management key of the unexpired
+// snippet with the given id.
+func (m *SnippetModel) CheckManageKey(ctx context.Context, id int, key string) (bool, error) {
+	var keyHash string
+	stmt := `SELECT manage_key_hash FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&keyHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+	return manageKeyMatches(keyHash, key), nil
+}
+
+// Update changes the title and content of an unexpired snippet. The previous
+// title and content are kept as a revision, in the same transaction. The
+// tombstones of burned snippets can't be updated.
+func (m *SnippetModel) Update(ctx context.Context, id int, title string, content string) error {
+	content, contentKey, keyID, err := m.Keys.seal(content)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO snippet_revisions (snippet_id, title, content, created, content_key, key_id)
+	SELECT id, title, content, UTC_TIMESTAMP(), content_key, key_id FROM snippets
+	WHERE expires > UTC_TIMESTAMP() AND id = ? AND burned_at IS NULL`
+	result, err := tx.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+	if err = checkAffected(result); err != nil {
+		return err
+	}
+
+	stmt = `UPDATE snippets SET title = ?, content = ?, content_key = ?, key_id = ? WHERE id = ?`
+	if _, err = tx.ExecContext(ctx, stmt, title, content, contentKey, keyID, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes an unexpired snippet.
+func (m *SnippetModel) Delete(ctx context.Context, id int) error {
+	stmt := `DELETE FROM snippets WHERE expires > UTC_TIMESTAMP() AND id = ?`
+	result, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// PurgeExpired deletes up to batchSize snippets which expired before the given
+// time, oldest first, along with their revisions, and returns how many it
+// deleted. Nothing else ever deletes expired snippets; they are merely hidden.
+func (m *SnippetModel) PurgeExpired(ctx context.Context, before time.Time, batchSize int) (int, error) {
+	// the revisions go with ON DELETE CASCADE
+	stmt := `DELETE FROM snippets WHERE expires <= ? ORDER BY expires LIMIT ?`
+	result, err := m.DB.ExecContext(ctx, stmt, before.UTC(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// Burn returns the unexpired, unread burn after reading snippet with the given
+// slug and, in the same transaction, leaves only its tombstone: the title,
+// content and revisions are wiped and burned_at records when it was read. So
+// however many readers race for the snippet, only one of them gets to see it.
+// Burn returns ErrNoRecord when there is no such snippet, which includes the
+// ones read already.
+func (m *SnippetModel) Burn(ctx context.Context, slug string) (*Snippet, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// claim the snippet first: the update locks its row, so a concurrent
+	// reader waits for this transaction and then finds burned_at set
+	stmt := `UPDATE snippets SET burned_at = UTC_TIMESTAMP()
+	WHERE expires > UTC_TIMESTAMP() AND slug = ? AND burn_after_reading AND burned_at IS NULL`
+	result, err := tx.ExecContext(ctx, stmt, slug)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkAffected(result); err != nil {
+		return nil, err
+	}
+
+	stmt = `SELECT id, title, content, created, expires, visibility, slug, share_token, burn_after_reading, burned_at, hashed_password, encrypted, content_key, key_id FROM snippets
+	WHERE slug = ?`
+	s, err := m.Keys.openSnippet(scanSnippet(tx.QueryRowContext(ctx, stmt, slug)))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE snippets SET title = '', content = '', content_key = '', key_id = '' WHERE id = ?`, s.ID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM snippet_revisions WHERE snippet_id = ?`, s.ID); err != nil {
+		return nil, err
+	}
+	return s, tx.Commit()
+}
+
+// RotateKeys re-encrypts a batch of rows with the current key, see KeyRotator.
+func (m *SnippetModel) RotateKeys(ctx context.Context, batchSize int) (int, error) {
+	return rotateKeys(ctx, m.DB, m.Keys, batchSize, func(query string) string { return query }, " FOR UPDATE")
+}
+
+// checkAffected returns ErrNoRecord if a statement didn't touch any row.
+func checkAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoRecord
+	}
+	return nil
+}
+
+// scanSnippet reads the single row of a snippet lookup (id, title, content,
+// created, expires, visibility, slug, share_token, burn_after_reading, burned_at,
+// hashed_password, encrypted).
+func scanSnippet(row *sql.Row) (*Snippet, error) {
+	s := &Snippet{}
+	var burnedAt sql.NullTime
+	err := row.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility, &s.Slug, &s.ShareToken,
+		&s.BurnAfterReading, &burnedAt, &s.HashedPassword, &s.Encrypted, &s.contentKey, &s.keyID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	s.BurnedAt = burnedAt.Time
+	return s, nil
+}
+
+// scanSnippets reads every row of a snippets query (id, title, content,
+// created, expires, visibility, slug) and closes the resultSet.
+func scanSnippets(rows *sql.Rows) ([]*Snippet, error) {
+	defer rows.Close()
+
+	var snippets []*Snippet
+	for rows.Next() {
+		s := &Snippet{}
+		err := rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility, &s.Slug, &s.contentKey, &s.keyID)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return snippets, nil
 }
@@ -0,0 +1,365 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemorySnippetModel is an in-memory implementation of SnippetStore. It needs no
+// database at all, which makes it handy for local development and for
+// exercising the handlers in tests. Data is lost when the process exits.
+type MemorySnippetModel struct {
+	mu       sync.RWMutex
+	nextID   int
+	snippets map[int]*Snippet
+	// slugs maps the slug of each snippet to its ID
+	slugs map[string]int
+	// keyHashes holds the management key hash of each snippet
+	keyHashes map[int]string
+	// revisions holds the revisions of each snippet, oldest first
+	revisions      map[int][]*Revision
+	nextRevisionID int
+}
+
+// NewMemorySnippetModel returns an empty, ready to use MemorySnippetModel.
+func NewMemorySnippetModel() *MemorySnippetModel {
+	return &MemorySnippetModel{
+		nextID:    1,
+		snippets:  make(map[int]*Snippet),
+		slugs:     make(map[string]int),
+		keyHashes: make(map[int]string),
+		revisions: make(map[int][]*Revision),
+	}
+}
+
+// Get returns the snippet with the given id, as long as it hasn't expired yet.
+func (m *MemorySnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.live(id)
+	if !ok {
+		return nil, ErrNoRecord
+	}
+	// Hand out a copy so callers can't mutate the stored snippet.
+	snippet := *s
+	return &snippet, nil
+}
+
+// GetBySlug returns the unexpired snippet with the given slug.
+func (m *MemorySnippetModel) GetBySlug(ctx context.Context, slug string) (*Snippet, error) {
+	m.mu.RLock()
+	id, ok := m.slugs[slug]
+	m.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNoRecord
+	}
+	return m.Get(ctx, id)
+}
+
+// Insert stores a new snippet which expires after the given number of days,
+// returning its ID and management key (see SnippetModel.Insert).
+func (m *MemorySnippetModel) Insert(ctx context.Context, title string, content string, expires int, visibility Visibility, burnAfterReading bool, password string, encrypted bool) (int, string, error) {
+	key, keyHash, err := newManageKey()
+	if err != nil {
+		return 0, "", err
+	}
+	hashedPassword, err := hashSnippetPassword(password)
+	if err != nil {
+		return 0, "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// unlike the SQL backends, the slug can be checked before inserting, as
+	// the lock is held
+	var slug string
+	for attempt := 1; ; attempt++ {
+		slug, err = newSlug()
+		if err != nil {
+			return 0, "", err
+		}
+		if _, taken := m.slugs[slug]; !taken {
+			break
+		}
+		if attempt == slugAttempts {
+			return 0, "", fmt.Errorf("models: no free slug found in %d attempts", slugAttempts)
+		}
+	}
+
+	now := time.Now().UTC()
+	id := m.nextID
+	m.nextID++
+
+	m.snippets[id] = &Snippet{
+		ID:               id,
+		Title:            title,
+		Content:          content,
+		Created:          now,
+		Expires:          now.AddDate(0, 0, expires),
+		Visibility:       visibility,
+		Slug:             slug,
+		BurnAfterReading: burnAfterReading,
+		HashedPassword:   []byte(hashedPassword),
+		Encrypted:        encrypted,
+	}
+	m.slugs[slug] = id
+	m.keyHashes[id] = keyHash
+	return id, key, nil
+}
+
+// Latest will return the 10 most recently created public snippets
+func (m *MemorySnippetModel) Latest(ctx context.Context) ([]*Snippet, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now().UTC()
+	var snippets []*Snippet
+	for _, s := range m.snippets {
+		if s.Expires.After(now) && s.Visibility == VisibilityPublic {
+			snippet := listed(s)
+			snippets = append(snippets, snippet)
+		}
+	}
+
+	// match the MySQL ordering: newest (highest id) first
+	sort.Slice(snippets, func(i, j int) bool {
+		return snippets[i].ID > snippets[j].ID
+	})
+	if len(snippets) > 10 {
+		snippets = snippets[:10]
+	}
+	return snippets, nil
+}
+
+// List returns one keyset paginated page of unexpired public snippets, see SnippetModel.List.
+func (m *MemorySnippetModel) List(ctx context.Context, sort SnippetSort, cursor string, limit int) (*SnippetPage, error) {
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	before := c != nil && c.Before
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now().UTC()
+	var snippets []*Snippet
+	for _, s := range m.snippets {
+		if !s.Expires.After(now) || s.Visibility != VisibilityPublic {
+			continue
+		}
+		// keep only the snippets that come after the cursor in the direction
+		// we're paging in, mirroring the keyset condition of the SQL backends
+		if c != nil {
+			key := &Snippet{ID: c.ID, Expires: c.Expires}
+			if before && !snippetLess(sort, s, key) || !before && !snippetLess(sort, key, s) {
+				continue
+			}
+		}
+		snippets = append(snippets, listed(s))
+	}
+
+	sortSnippets(sort, snippets, before)
+	if len(snippets) > limit+1 {
+		snippets = snippets[:limit+1]
+	}
+	return newPage(snippets, c, limit), nil
+}
+
+// snippetLess reports whether a is listed before b in the given sort order.
+func snippetLess(order SnippetSort, a, b *Snippet) bool {
+	switch order {
+	case SortOldest:
+		return a.ID < b.ID
+	case SortExpiring:
+		if !a.Expires.Equal(b.Expires) {
+			return a.Expires.Before(b.Expires)
+		}
+		return a.ID < b.ID
+	default:
+		return a.ID > b.ID
+	}
+}
+
+// sortSnippets sorts snippets in the given order, or in reverse if reverse is set.
+func sortSnippets(order SnippetSort, snippets []*Snippet, reverse bool) {
+	sort.Slice(snippets, func(i, j int) bool {
+		if reverse {
+			return snippetLess(order, snippets[j], snippets[i])
+		}
+		return snippetLess(order, snippets[i], snippets[j])
+	})
+}
+
+// Search returns up to limit unexpired public snippets containing every word of the
+// query in their title or content, best match first. Encrypted snippets are left out.
+func (m *MemorySnippetModel) Search(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now().UTC()
+	var results []*SearchResult
+	for _, s := range m.snippets {
+		if !s.Expires.After(now) || s.Visibility != VisibilityPublic || s.Encrypted {
+			continue
+		}
+		if rank := rankSnippet(s, terms); rank > 0 {
+			results = append(results, &SearchResult{Snippet: listed(s), Rank: rank})
+		}
+	}
+	return sortResults(results, limit), nil
+}
+
+// CheckManageKey reports whether key is the management key of the unexpired
+// snippet with the given id.
+func (m *MemorySnippetModel) CheckManageKey(ctx context.Context, id int, key string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.live(id); !ok {
+		return false, ErrNoRecord
+	}
+	return manageKeyMatches(m.keyHashes[id], key), nil
+}
+
+// Update changes the title and content of an unexpired snippet, keeping the
+// previous ones as a revision. The tombstones of burned snippets can't be updated.
+func (m *MemorySnippetModel) Update(ctx context.Context, id int, title string, content string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.live(id)
+	if !ok || s.Burned() {
+		return ErrNoRecord
+	}
+
+	// keep the previous title and content as a revision
+	m.nextRevisionID++
+	m.revisions[id] = append(m.revisions[id], &Revision{
+		ID:        m.nextRevisionID,
+		SnippetID: id,
+		Title:     s.Title,
+		Content:   s.Content,
+		Created:   time.Now().UTC(),
+	})
+
+	s.Title = title
+	s.Content = content
+	return nil
+}
+
+// Burn returns the unread burn after reading snippet with the given slug and
+// leaves only its tombstone (see SnippetModel.Burn).
+func (m *MemorySnippetModel) Burn(ctx context.Context, slug string) (*Snippet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.live(m.slugs[slug])
+	if !ok || !s.BurnAfterReading || s.Burned() {
+		return nil, ErrNoRecord
+	}
+
+	s.BurnedAt = time.Now().UTC()
+	snippet := *s
+	s.Title = ""
+	s.Content = ""
+	delete(m.revisions, s.ID)
+	return &snippet, nil
+}
+
+// Delete removes an unexpired snippet.
+func (m *MemorySnippetModel) Delete(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.live(id); !ok {
+		return ErrNoRecord
+	}
+	delete(m.slugs, m.snippets[id].Slug)
+	delete(m.snippets, id)
+	delete(m.keyHashes, id)
+	delete(m.revisions, id)
+	return nil
+}
+
+// PurgeExpired deletes up to batchSize snippets which expired before the given
+// time, along with their revisions, and returns how many it deleted.
+func (m *MemorySnippetModel) PurgeExpired(ctx context.Context, before time.Time, batchSize int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, s := range m.snippets {
+		if n == batchSize {
+			break
+		}
+		if s.Expires.After(before) {
+			continue
+		}
+		delete(m.slugs, s.Slug)
+		delete(m.snippets, id)
+		delete(m.keyHashes, id)
+		delete(m.revisions, id)
+		n++
+	}
+	return n, nil
+}
+
+// Revisions returns the revisions of a snippet, most recent first.
+func (m *MemorySnippetModel) Revisions(ctx context.Context, id int) ([]*Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stored := m.revisions[id]
+	revisions := make([]*Revision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revision := *stored[i]
+		revisions = append(revisions, &revision)
+	}
+	return revisions, nil
+}
+
+// GetRevision returns a single revision of a snippet.
+func (m *MemorySnippetModel) GetRevision(ctx context.Context, id int, revisionID int) (*Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, r := range m.revisions[id] {
+		if r.ID == revisionID {
+			revision := *r
+			return &revision, nil
+		}
+	}
+	return nil, ErrNoRecord
+}
+
+// listed returns a copy of a stored snippet as the listings return it, that is
+// without its share token and password hash (which the SQL backends only load
+// for single snippets).
+func listed(s *Snippet) *Snippet {
+	snippet := *s
+	snippet.ShareToken = ""
+	snippet.HashedPassword = nil
+	return &snippet
+}
+
+// live returns the stored snippet with the given id if it hasn't expired yet.
+// The caller must hold the lock.
+func (m *MemorySnippetModel) live(id int) (*Snippet, bool) {
+	s, ok := m.snippets[id]
+	if !ok || !s.Expires.After(time.Now().UTC()) {
+		return nil, false
+	}
+	return s, true
+}
@@ -0,0 +1,314 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgresSnippetModel implements SnippetStore on top of PostgreSQL. The created
+// and expires columns are TIMESTAMPTZ, so NOW() and interval arithmetic replace
+// MySQL's UTC_TIMESTAMP() and DATE_ADD().
+type PostgresSnippetModel struct {
+	DB *sql.DB
+	// Keys encrypts content at rest, see SnippetModel.
+	Keys *KeyRing
+}
+
+func (m *PostgresSnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, share_token, burn_after_reading, burned_at, hashed_password, encrypted, content_key, key_id FROM snippets
+	WHERE expires > NOW() AND id = $1`
+	return m.Keys.openSnippet(scanSnippet(m.DB.QueryRowContext(ctx, stmt, id)))
+}
+
+// GetBySlug returns the unexpired snippet with the given slug.
+func (m *PostgresSnippetModel) GetBySlug(ctx context.Context, slug string) (*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, share_token, burn_after_reading, burned_at, hashed_password, encrypted, content_key, key_id FROM snippets
+	WHERE expires > NOW() AND slug = $1`
+	return m.Keys.openSnippet(scanSnippet(m.DB.QueryRowContext(ctx, stmt, slug)))
+}
+
+// Insert a new snippet into the database, returning its ID and management
+// key (see SnippetModel.Insert). PostgreSQL has no LastInsertId(), so the new
+// id is read back with a RETURNING clause instead.
+func (m *PostgresSnippetModel) Insert(ctx context.Context, title string, content string, expires int, visibility Visibility, burnAfterReading bool, password string, encrypted bool) (int, string, error) {
+	key, keyHash, err := newManageKey()
+	if err != nil {
+		return 0, "", err
+	}
+	hashedPassword, err := hashSnippetPassword(password)
+	if err != nil {
+		return 0, "", err
+	}
+	content, contentKey, keyID, err := m.Keys.seal(content)
+	if err != nil {
+		return 0, "", err
+	}
+
+	stmt := `INSERT INTO snippets (title, content, created, expires, manage_key_hash, visibility, slug, burn_after_reading, hashed_password, encrypted, content_key, key_id)
+	VALUES($1, $2, NOW(), NOW() + make_interval(days => $3), $4, $5, $6, $7, $8, $9, $10, $11)
+	RETURNING id`
+
+	for attempt := 1; ; attempt++ {
+		slug, err := newSlug()
+		if err != nil {
+			return 0, "", err
+		}
+
+		var id int
+		err = m.DB.QueryRowContext(ctx, stmt, title, content, expires, keyHash, string(visibility), slug, burnAfterReading, hashedPassword, encrypted, contentKey, keyID).Scan(&id)
+		if err != nil {
+			if attempt < slugAttempts && isDuplicateSlugPostgres(err) {
+				continue
+			}
+			return 0, "", err
+		}
+
+		return id, key, nil
+	}
+}
+
+// isDuplicateSlugPostgres reports whether err is the violation of the unique
+// index on the slug column (23505 is PostgreSQL's unique_violation).
+func isDuplicateSlugPostgres(err error) bool {
+	var pgError *pgconn.PgError
+	return errors.As(err, &pgError) && pgError.Code == "23505" && pgError.ConstraintName == "idx_snippets_slug"
+}
+
+// Latest will return the 10 most recently created snippets
+func (m *PostgresSnippetModel) Latest(ctx context.Context) ([]*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id FROM snippets
+	WHERE expires > NOW() AND visibility = 'public' ORDER BY id DESC LIMIT 10`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility, &s.Slug, &s.contentKey, &s.keyID)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return m.Keys.openSnippets(snippets, nil)
+}
+
+// List returns one keyset paginated page of unexpired public snippets, see SnippetModel.List.
+func (m *PostgresSnippetModel) List(ctx context.Context, sort SnippetSort, cursor string, limit int) (*SnippetPage, error) {
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	condition, args, order := keyset(sort, c)
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id FROM snippets
+	WHERE expires > NOW() AND visibility = 'public'`
+	if condition != "" {
+		stmt += " AND " + condition
+	}
+	stmt += " ORDER BY " + order + " LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := m.DB.QueryContext(ctx, rebind(stmt), args...)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := m.Keys.openSnippets(scanSnippets(rows))
+	if err != nil {
+		return nil, err
+	}
+	return newPage(snippets, c, limit), nil
+}
+
+// Search returns up to limit unexpired public snippets matching query, best match
+// first, leaving out encrypted snippets. The to_tsvector() expression must match the one of the
+// idx_snippets_search index for the index to be used. With content encrypted
+// at rest the index is of no use, see searchDecrypted.
+func (m *PostgresSnippetModel) Search(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	if m.Keys != nil {
+		stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id FROM snippets
+		WHERE expires > NOW() AND visibility = 'public' AND NOT encrypted
+		ORDER BY id DESC LIMIT $1`
+		return searchDecrypted(ctx, m.DB, m.Keys, stmt, terms, limit)
+	}
+
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id,
+	ts_rank(to_tsvector('english', title || ' ' || content), query) AS rank
+	FROM snippets, plainto_tsquery('english', $1) query
+	WHERE expires > NOW() AND visibility = 'public' AND NOT encrypted
+	AND to_tsvector('english', title || ' ' || content) @@ query
+	ORDER BY rank DESC, id DESC LIMIT $2`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	return m.Keys.openSearchResults(scanSearchResults(rows))
+}
+
+// CheckManageKey reports whether key is the management key of the unexpired
+// snippet with the given id.
+func (m *PostgresSnippetModel) CheckManageKey(ctx context.Context, id int, key string) (bool, error) {
+	var keyHash string
+	stmt := `SELECT manage_key_hash FROM snippets WHERE expires > NOW() AND id = $1`
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&keyHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+	return manageKeyMatches(keyHash, key), nil
+}
+
+// Update changes the title and content of an unexpired snippet. The previous
+// title and content are kept as a revision, in the same transaction. The
+// tombstones of burned snippets can't be updated.
+func (m *PostgresSnippetModel) Update(ctx context.Context, id int, title string, content string) error {
+	content, contentKey, keyID, err := m.Keys.seal(content)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO snippet_revisions (snippet_id, title, content, created, content_key, key_id)
+	SELECT id, title, content, NOW(), content_key, key_id FROM snippets
+	WHERE expires > NOW() AND id = $1 AND burned_at IS NULL`
+	result, err := tx.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+	if err = checkAffected(result); err != nil {
+		return err
+	}
+
+	stmt = `UPDATE snippets SET title = $1, content = $2, content_key = $3, key_id = $4 WHERE id = $5`
+	if _, err = tx.ExecContext(ctx, stmt, title, content, contentKey, keyID, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes an unexpired snippet.
+func (m *PostgresSnippetModel) Delete(ctx context.Context, id int) error {
+	stmt := `DELETE FROM snippets WHERE expires > NOW() AND id = $1`
+	result, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// PurgeExpired deletes up to batchSize snippets which expired before the given
+// time, see SnippetModel.PurgeExpired. PostgreSQL's DELETE has no LIMIT, so
+// the batch is picked by a subquery.
+func (m *PostgresSnippetModel) PurgeExpired(ctx context.Context, before time.Time, batchSize int) (int, error) {
+	stmt := `DELETE FROM snippets WHERE id IN (
+		SELECT id FROM snippets WHERE expires <= $1 ORDER BY expires LIMIT $2
+	)`
+	result, err := m.DB.ExecContext(ctx, stmt, before, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// Burn returns the unread burn after reading snippet with the given slug and
+// leaves only its tombstone, in one transaction (see SnippetModel.Burn).
+func (m *PostgresSnippetModel) Burn(ctx context.Context, slug string) (*Snippet, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET burned_at = NOW()
+	WHERE expires > NOW() AND slug = $1 AND burn_after_reading AND burned_at IS NULL`
+	result, err := tx.ExecContext(ctx, stmt, slug)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkAffected(result); err != nil {
+		return nil, err
+	}
+
+	stmt = `SELECT id, title, content, created, expires, visibility, slug, share_token, burn_after_reading, burned_at, hashed_password, encrypted, content_key, key_id FROM snippets
+	WHERE slug = $1`
+	s, err := m.Keys.openSnippet(scanSnippet(tx.QueryRowContext(ctx, stmt, slug)))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE snippets SET title = '', content = '', content_key = '', key_id = '' WHERE id = $1`, s.ID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM snippet_revisions WHERE snippet_id = $1`, s.ID); err != nil {
+		return nil, err
+	}
+	return s, tx.Commit()
+}
+
+// RotateKeys re-encrypts a batch of rows with the current key, see KeyRotator.
+func (m *PostgresSnippetModel) RotateKeys(ctx context.Context, batchSize int) (int, error) {
+	return rotateKeys(ctx, m.DB, m.Keys, batchSize, rebind, " FOR UPDATE")
+}
+
+// rebind turns the ? placeholders of SQL shared with the other backends into
+// PostgreSQL's $1, $2, ... placeholders.
+func rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Revisions returns the revisions of a snippet, most recent first.
+func (m *PostgresSnippetModel) Revisions(ctx context.Context, id int) ([]*Revision, error) {
+	stmt := `SELECT id, snippet_id, title, content, created, content_key, key_id FROM snippet_revisions
+	WHERE snippet_id = $1 ORDER BY id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.Keys.openRevisions(scanRevisions(rows))
+}
+
+// GetRevision returns a single revision of a snippet.
+func (m *PostgresSnippetModel) GetRevision(ctx context.Context, id int, revisionID int) (*Revision, error) {
+	stmt := `SELECT id, snippet_id, title, content, created, content_key, key_id FROM snippet_revisions
+	WHERE snippet_id = $1 AND id = $2`
+	return m.Keys.openRevision(scanRevision(m.DB.QueryRowContext(ctx, stmt, id, revisionID)))
+}
@@ -0,0 +1,354 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SQLiteSnippetModel implements SnippetStore on top of SQLite. Timestamps are
+// stored as UTC DATETIME values, and datetime('now') takes the place of MySQL's
+// UTC_TIMESTAMP() so the expiry semantics match SnippetModel.
+type SQLiteSnippetModel struct {
+	DB *sql.DB
+	// Keys encrypts content at rest, see SnippetModel.
+	Keys *KeyRing
+}
+
+func (m *SQLiteSnippetModel) Get(ctx context.Context, id int) (*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, share_token, burn_after_reading, burned_at, hashed_password, encrypted, content_key, key_id FROM snippets
+	WHERE expires > datetime('now') AND id = ?`
+	return m.Keys.openSnippet(scanSnippet(m.DB.QueryRowContext(ctx, stmt, id)))
+}
+
+// GetBySlug returns the unexpired snippet with the given slug.
+func (m *SQLiteSnippetModel) GetBySlug(ctx context.Context, slug string) (*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, share_token, burn_after_reading, burned_at, hashed_password, encrypted, content_key, key_id FROM snippets
+	WHERE expires > datetime('now') AND slug = ?`
+	return m.Keys.openSnippet(scanSnippet(m.DB.QueryRowContext(ctx, stmt, slug)))
+}
+
+// Insert a new snippet into the database, returning its ID and management
+// key (see SnippetModel.Insert).
+func (m *SQLiteSnippetModel) Insert(ctx context.Context, title string, content string, expires int, visibility Visibility, burnAfterReading bool, password string, encrypted bool) (int, string, error) {
+	key, keyHash, err := newManageKey()
+	if err != nil {
+		return 0, "", err
+	}
+	hashedPassword, err := hashSnippetPassword(password)
+	if err != nil {
+		return 0, "", err
+	}
+	content, contentKey, keyID, err := m.Keys.seal(content)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// datetime() modifiers are strings like '+7 days', so the number of days
+	// is concatenated onto the modifier rather than interpolated into the SQL.
+	stmt := `INSERT INTO snippets (title, content, created, expires, manage_key_hash, visibility, slug, burn_after_reading, hashed_password, encrypted, content_key, key_id)
+	VALUES(?, ?, datetime('now'), datetime('now', '+' || ? || ' days'), ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	for attempt := 1; ; attempt++ {
+		slug, err := newSlug()
+		if err != nil {
+			return 0, "", err
+		}
+
+		result, err := m.DB.ExecContext(ctx, stmt, title, content, expires, keyHash, string(visibility), slug, burnAfterReading, hashedPassword, encrypted, contentKey, keyID)
+		if err != nil {
+			if attempt < slugAttempts && isDuplicateSlugSQLite(err) {
+				continue
+			}
+			return 0, "", err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, "", err
+		}
+
+		return int(id), key, nil
+	}
+}
+
+// isDuplicateSlugSQLite reports whether err is the violation of the unique
+// index on the slug column.
+func isDuplicateSlugSQLite(err error) bool {
+	var sqliteError sqlite3.Error
+	return errors.As(err, &sqliteError) && sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique &&
+		strings.Contains(sqliteError.Error(), "snippets.slug")
+}
+
+// Latest will return the 10 most recently created snippets
+func (m *SQLiteSnippetModel) Latest(ctx context.Context) ([]*Snippet, error) {
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id FROM snippets
+	WHERE expires > datetime('now') AND visibility = 'public' ORDER BY id DESC LIMIT 10`
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snippets []*Snippet
+	for rows.Next() {
+		s := &Snippet{}
+		err = rows.Scan(&s.ID, &s.Title, &s.Content, &s.Created, &s.Expires, &s.Visibility, &s.Slug, &s.contentKey, &s.keyID)
+		if err != nil {
+			return nil, err
+		}
+		snippets = append(snippets, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return m.Keys.openSnippets(snippets, nil)
+}
+
+// List returns one keyset paginated page of unexpired public snippets, see SnippetModel.List.
+func (m *SQLiteSnippetModel) List(ctx context.Context, sort SnippetSort, cursor string, limit int) (*SnippetPage, error) {
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	condition, args, order := keyset(sort, c)
+	stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id FROM snippets
+	WHERE expires > datetime('now') AND visibility = 'public'`
+	if condition != "" {
+		stmt += " AND " + condition
+	}
+	stmt += " ORDER BY " + order + " LIMIT ?"
+	args = append(args, limit+1)
+
+	rows, err := m.DB.QueryContext(ctx, stmt, sqliteArgs(args)...)
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := m.Keys.openSnippets(scanSnippets(rows))
+	if err != nil {
+		return nil, err
+	}
+	return newPage(snippets, c, limit), nil
+}
+
+// Search returns up to limit unexpired public snippets matching query, best match
+// first, leaving out encrypted snippets. Matching uses the snippets_fts FTS4 table; as FTS4 has no built-in
+// ranking function the matches are ranked in Go. With content encrypted at
+// rest the FTS table is of no use, see searchDecrypted.
+func (m *SQLiteSnippetModel) Search(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	if m.Keys != nil {
+		stmt := `SELECT id, title, content, created, expires, visibility, slug, content_key, key_id FROM snippets
+		WHERE expires > datetime('now') AND visibility = 'public' AND NOT encrypted
+		ORDER BY id DESC LIMIT ?`
+		return searchDecrypted(ctx, m.DB, m.Keys, stmt, terms, limit)
+	}
+
+	// quote every term so it is matched literally, rather than being
+	// interpreted as FTS query syntax
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"`
+	}
+
+	stmt := `SELECT s.id, s.title, s.content, s.created, s.expires, s.visibility, s.slug, s.content_key, s.key_id
+	FROM snippets_fts f JOIN snippets s ON s.id = f.docid
+	WHERE snippets_fts MATCH ? AND s.expires > datetime('now') AND s.visibility = 'public' AND NOT s.encrypted`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, strings.Join(quoted, " "))
+	if err != nil {
+		return nil, err
+	}
+	snippets, err := m.Keys.openSnippets(scanSnippets(rows))
+	if err != nil {
+		return nil, err
+	}
+	return rankSnippets(snippets, terms, limit), nil
+}
+
+// CheckManageKey reports whether key is the management key of the unexpired
+// snippet with the given id.
+func (m *SQLiteSnippetModel) CheckManageKey(ctx context.Context, id int, key string) (bool, error) {
+	var keyHash string
+	stmt := `SELECT manage_key_hash FROM snippets WHERE expires > datetime('now') AND id = ?`
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&keyHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrNoRecord
+		}
+		return false, err
+	}
+	return manageKeyMatches(keyHash, key), nil
+}
+
+// Update changes the title and content of an unexpired snippet. The previous
+// title and content are kept as a revision, in the same transaction. The
+// tombstones of burned snippets can't be updated.
+func (m *SQLiteSnippetModel) Update(ctx context.Context, id int, title string, content string) error {
+	content, contentKey, keyID, err := m.Keys.seal(content)
+	if err != nil {
+		return err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Rollback is a no-op once the transaction has been committed.
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO snippet_revisions (snippet_id, title, content, created, content_key, key_id)
+	SELECT id, title, content, datetime('now'), content_key, key_id FROM snippets
+	WHERE expires > datetime('now') AND id = ? AND burned_at IS NULL`
+	result, err := tx.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+	if err = checkAffected(result); err != nil {
+		return err
+	}
+
+	stmt = `UPDATE snippets SET title = ?, content = ?, content_key = ?, key_id = ? WHERE id = ?`
+	if _, err = tx.ExecContext(ctx, stmt, title, content, contentKey, keyID, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes an unexpired snippet along with its revisions. SQLite only
+// enforces foreign keys (and so ON DELETE CASCADE) when they are enabled on
+// the connection, so the revisions are deleted explicitly.
+func (m *SQLiteSnippetModel) Delete(ctx context.Context, id int) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `DELETE FROM snippets WHERE expires > datetime('now') AND id = ?`
+	result, err := tx.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+	if err = checkAffected(result); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM snippet_revisions WHERE snippet_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeExpired deletes up to batchSize snippets which expired before the given
+// time, see SnippetModel.PurgeExpired. As in Delete, the revisions are deleted
+// explicitly; both statements pick the same batch, as the transaction holds
+// the write lock in between.
+func (m *SQLiteSnippetModel) PurgeExpired(ctx context.Context, before time.Time, batchSize int) (int, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	batch := `SELECT id FROM snippets WHERE expires <= ? ORDER BY expires, id LIMIT ?`
+	args := sqliteArgs([]any{before, batchSize})
+	if _, err = tx.ExecContext(ctx, `DELETE FROM snippet_revisions WHERE snippet_id IN (`+batch+`)`, args...); err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM snippets WHERE id IN (`+batch+`)`, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// Burn returns the unread burn after reading snippet with the given slug and
+// leaves only its tombstone, in one transaction (see SnippetModel.Burn).
+// SQLite has no row locks, but the first update takes the database write
+// lock, which serialises concurrent readers just the same.
+func (m *SQLiteSnippetModel) Burn(ctx context.Context, slug string) (*Snippet, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE snippets SET burned_at = datetime('now')
+	WHERE expires > datetime('now') AND slug = ? AND burn_after_reading AND burned_at IS NULL`
+	result, err := tx.ExecContext(ctx, stmt, slug)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkAffected(result); err != nil {
+		return nil, err
+	}
+
+	stmt = `SELECT id, title, content, created, expires, visibility, slug, share_token, burn_after_reading, burned_at, hashed_password, encrypted, content_key, key_id FROM snippets
+	WHERE slug = ?`
+	s, err := m.Keys.openSnippet(scanSnippet(tx.QueryRowContext(ctx, stmt, slug)))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = tx.ExecContext(ctx, `UPDATE snippets SET title = '', content = '', content_key = '', key_id = '' WHERE id = ?`, s.ID); err != nil {
+		return nil, err
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM snippet_revisions WHERE snippet_id = ?`, s.ID); err != nil {
+		return nil, err
+	}
+	return s, tx.Commit()
+}
+
+// RotateKeys re-encrypts a batch of rows with the current key, see KeyRotator.
+// The batch isn't locked, as the write lock of the updates serialises writers.
+func (m *SQLiteSnippetModel) RotateKeys(ctx context.Context, batchSize int) (int, error) {
+	return rotateKeys(ctx, m.DB, m.Keys, batchSize, func(query string) string { return query }, "")
+}
+
+// sqliteArgs formats time.Time arguments the same way datetime() does, so
+// they compare correctly against the stored DATETIME text.
+func sqliteArgs(args []any) []any {
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			args[i] = t.UTC().Format(sqliteTimeFormat)
+		}
+	}
+	return args
+}
+
+// sqliteTimeFormat is the layout of datetime('now') values.
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// Revisions returns the revisions of a snippet, most recent first.
+func (m *SQLiteSnippetModel) Revisions(ctx context.Context, id int) ([]*Revision, error) {
+	stmt := `SELECT id, snippet_id, title, content, created, content_key, key_id FROM snippet_revisions
+	WHERE snippet_id = ? ORDER BY id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.Keys.openRevisions(scanRevisions(rows))
+}
+
+// GetRevision returns a single revision of a snippet.
+func (m *SQLiteSnippetModel) GetRevision(ctx context.Context, id int, revisionID int) (*Revision, error) {
+	stmt := `SELECT id, snippet_id, title, content, created, content_key, key_id FROM snippet_revisions
+	WHERE snippet_id = ? AND id = ?`
+	return m.Keys.openRevision(scanRevision(m.DB.QueryRowContext(ctx, stmt, id, revisionID)))
+}
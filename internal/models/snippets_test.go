@@ -0,0 +1,280 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnippetStoreRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		ctx := context.Background()
+		snippets := stores.Snippets
+
+		id, key, err := snippets.Insert(ctx, "An old silent pond", "An old silent pond...\nA frog jumps into the pond,", 7, VisibilityPublic, false, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		snippet, err := snippets.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snippet.ID != id || snippet.Title != "An old silent pond" || snippet.Content != "An old silent pond...\nA frog jumps into the pond," {
+			t.Errorf("got snippet %+v; want the inserted one", snippet)
+		}
+		if snippet.Visibility != VisibilityPublic || snippet.Encrypted || snippet.BurnAfterReading {
+			t.Errorf("got snippet %+v; want a public snippet", snippet)
+		}
+		if lifetime := snippet.Expires.Sub(snippet.Created); lifetime < 7*24*time.Hour-time.Minute || lifetime > 7*24*time.Hour+time.Minute {
+			t.Errorf("got a lifetime of %s; want 7 days", lifetime)
+		}
+
+		bySlug, err := snippets.GetBySlug(ctx, snippet.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bySlug.ID != id {
+			t.Errorf("got snippet %d by slug; want %d", bySlug.ID, id)
+		}
+
+		latest, err := snippets.Latest(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(latest) != 1 || latest[0].ID != id {
+			t.Errorf("got %d latest snippets; want the inserted one", len(latest))
+		}
+
+		if ok, err := snippets.CheckManageKey(ctx, id, key); err != nil || !ok {
+			t.Errorf("got %t, %v checking the management key; want true", ok, err)
+		}
+		if ok, err := snippets.CheckManageKey(ctx, id, "wrong"); err != nil || ok {
+			t.Errorf("got %t, %v checking a wrong management key; want false", ok, err)
+		}
+
+		if err := snippets.Update(ctx, id, "A new title", "New content"); err != nil {
+			t.Fatal(err)
+		}
+		revisions, err := snippets.Revisions(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 1 || revisions[0].Title != "An old silent pond" {
+			t.Fatalf("got revisions %+v; want the version before the update", revisions)
+		}
+		revision, err := snippets.GetRevision(ctx, id, revisions[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revision.Content != "An old silent pond...\nA frog jumps into the pond," {
+			t.Errorf("got revision content %q; want the content before the update", revision.Content)
+		}
+
+		if err := snippets.Delete(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := snippets.Get(ctx, id); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v getting a deleted snippet; want ErrNoRecord", err)
+		}
+	})
+}
+
+func TestSnippetStoreGetUnknown(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		if _, err := stores.Snippets.Get(context.Background(), 42); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v; want ErrNoRecord", err)
+		}
+		if _, err := stores.Snippets.GetBySlug(context.Background(), "nope"); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v; want ErrNoRecord", err)
+		}
+	})
+}
+
+func TestSnippetStoreNoShareToken(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		id, _, err := stores.Snippets.Insert(context.Background(), "Unlisted", "Only by link", 7, VisibilityUnlisted, false, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snippet, err := stores.Snippets.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snippet.ShareToken != "" {
+			t.Errorf("got share token %q; want none", snippet.ShareToken)
+		}
+		if snippet.ShareTokenMatches("") {
+			t.Error("the empty share token matches a snippet without one")
+		}
+	})
+}
+
+func TestSnippetStorePassword(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		ctx := context.Background()
+		open, _, err := stores.Snippets.Insert(ctx, "Open", "For everyone", 7, VisibilityPublic, false, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		locked, _, err := stores.Snippets.Insert(ctx, "Locked", "For some", 7, VisibilityPublic, false, "pa$$word", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		snippet, err := stores.Snippets.Get(ctx, open)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snippet.PasswordProtected() {
+			t.Errorf("snippet without a password is password protected: %q", snippet.HashedPassword)
+		}
+
+		snippet, err = stores.Snippets.Get(ctx, locked)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !snippet.PasswordProtected() || !snippet.PasswordMatches("pa$$word") || snippet.PasswordMatches("wrong") {
+			t.Error("snippet with a password doesn't check it")
+		}
+	})
+}
+
+func TestSQLiteQueryInterrupted(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_busy_timeout=5000"
+	db := newTestDB(t, "sqlite3", dsn, "sqlite")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// counts for ever, until the driver interrupts it at the deadline
+	stmt := `WITH RECURSIVE counter(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM counter) SELECT COUNT(*) FROM counter`
+	var n int
+	err := db.QueryRowContext(ctx, stmt).Scan(&n)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v; want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSnippetStoreBurn(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		ctx := context.Background()
+		snippets := stores.Snippets
+
+		id, _, err := snippets.Insert(ctx, "Secret", "First draft", 7, VisibilityUnlisted, true, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// leave a revision behind, which must burn too
+		if err := snippets.Update(ctx, id, "Secret", "Read me once"); err != nil {
+			t.Fatal(err)
+		}
+		snippet, err := snippets.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snippet.Burned() {
+			t.Fatal("the snippet burned before being read")
+		}
+
+		burned, err := snippets.Burn(ctx, snippet.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if burned.ID != id || burned.Title != "Secret" || burned.Content != "Read me once" || !burned.Burned() {
+			t.Errorf("got snippet %+v; want it whole, burned", burned)
+		}
+
+		if _, err := snippets.Burn(ctx, snippet.Slug); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v burning twice; want ErrNoRecord", err)
+		}
+
+		tombstone, err := snippets.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tombstone.Burned() || tombstone.Title != "" || tombstone.Content != "" {
+			t.Errorf("got snippet %+v; want its tombstone", tombstone)
+		}
+		revisions, err := snippets.Revisions(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 0 {
+			t.Errorf("got %d revisions of a burned snippet; want none", len(revisions))
+		}
+
+		// snippets which don't burn after reading can't be burned
+		other, _, err := snippets.Insert(ctx, "Keeper", "Read me often", 7, VisibilityPublic, false, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		snippet, err = snippets.Get(ctx, other)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := snippets.Burn(ctx, snippet.Slug); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v burning a snippet which doesn't burn after reading; want ErrNoRecord", err)
+		}
+		if _, err := snippets.Burn(ctx, "nope"); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v burning an unknown snippet; want ErrNoRecord", err)
+		}
+	})
+}
+
+func TestSnippetStorePurgeExpired(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		ctx := context.Background()
+		now := time.Now()
+
+		// five expired snippets, of which the first and third have revisions,
+		// and two unexpired ones, the first of which has a revision too
+		ids := make([]int, 7)
+		for i := range ids {
+			id, _, err := stores.Snippets.Insert(ctx, "Title", "Content", 7, VisibilityPublic, false, "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids[i] = id
+		}
+		for _, i := range []int{0, 2, 5} {
+			if err := stores.Snippets.Update(ctx, ids[i], "Title", "Edited"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := range 5 {
+			stores.setExpires(t, ids[i], now.Add(-time.Duration(i+1)*time.Hour))
+		}
+		stores.setExpires(t, ids[6], now.Add(time.Hour))
+
+		var batches []int
+		for {
+			n, err := stores.Snippets.PurgeExpired(ctx, now, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n == 0 {
+				break
+			}
+			batches = append(batches, n)
+		}
+		if want := []int{2, 2, 1}; !reflect.DeepEqual(batches, want) {
+			t.Errorf("purged batches of %v; want %v", batches, want)
+		}
+
+		for i, id := range ids {
+			found, revisions := stores.stored(t, id)
+			if i < 5 && (found || revisions != 0) {
+				t.Errorf("expired snippet %d: got stored %t with %d revisions; want it purged", i, found, revisions)
+			}
+			if i == 5 && (!found || revisions != 1) {
+				t.Errorf("unexpired snippet: got stored %t with %d revisions; want it kept with 1", found, revisions)
+			}
+			if i == 6 && (!found || revisions != 0) {
+				t.Errorf("unexpired snippet: got stored %t with %d revisions; want it kept", found, revisions)
+			}
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// TimeoutSnippetStore wraps a SnippetStore, giving every call Timeout to
+// finish on top of the deadline of the context it is called with. Past it,
+// the query is canceled and the call returns an error wrapping
+// context.DeadlineExceeded.
+type TimeoutSnippetStore struct {
+	Store   SnippetStore
+	Timeout time.Duration
+}
+
+func (t *TimeoutSnippetStore) Get(ctx context.Context, id int) (*Snippet, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Get(ctx, id)
+}
+
+func (t *TimeoutSnippetStore) GetBySlug(ctx context.Context, slug string) (*Snippet, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.GetBySlug(ctx, slug)
+}
+
+func (t *TimeoutSnippetStore) Insert(ctx context.Context, title string, content string, expires int, visibility Visibility, burnAfterReading bool, password string, encrypted bool) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Insert(ctx, title, content, expires, visibility, burnAfterReading, password, encrypted)
+}
+
+func (t *TimeoutSnippetStore) Burn(ctx context.Context, slug string) (*Snippet, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Burn(ctx, slug)
+}
+
+func (t *TimeoutSnippetStore) Latest(ctx context.Context) ([]*Snippet, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Latest(ctx)
+}
+
+func (t *TimeoutSnippetStore) List(ctx context.Context, sort SnippetSort, cursor string, limit int) (*SnippetPage, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.List(ctx, sort, cursor, limit)
+}
+
+func (t *TimeoutSnippetStore) Search(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Search(ctx, query, limit)
+}
+
+func (t *TimeoutSnippetStore) CheckManageKey(ctx context.Context, id int, key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.CheckManageKey(ctx, id, key)
+}
+
+func (t *TimeoutSnippetStore) Update(ctx context.Context, id int, title string, content string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Update(ctx, id, title, content)
+}
+
+func (t *TimeoutSnippetStore) Delete(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Delete(ctx, id)
+}
+
+func (t *TimeoutSnippetStore) Revisions(ctx context.Context, id int) ([]*Revision, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Revisions(ctx, id)
+}
+
+func (t *TimeoutSnippetStore) GetRevision(ctx context.Context, id int, revisionID int) (*Revision, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.GetRevision(ctx, id, revisionID)
+}
+
+func (t *TimeoutSnippetStore) PurgeExpired(ctx context.Context, before time.Time, batchSize int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.PurgeExpired(ctx, before, batchSize)
+}
+
+// TimeoutUserStore wraps a UserStore, giving every call Timeout to finish,
+// see TimeoutSnippetStore.
+type TimeoutUserStore struct {
+	Store   UserStore
+	Timeout time.Duration
+}
+
+func (t *TimeoutUserStore) Insert(ctx context.Context, name string, email string, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Insert(ctx, name, email, password)
+}
+
+func (t *TimeoutUserStore) Authenticate(ctx context.Context, email string, password string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Authenticate(ctx, email, password)
+}
+
+func (t *TimeoutUserStore) Exists(ctx context.Context, id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Exists(ctx, id)
+}
+
+func (t *TimeoutUserStore) Get(ctx context.Context, id int) (*User, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Get(ctx, id)
+}
+
+// TimeoutTokenStore wraps a TokenStore, giving every call Timeout to finish,
+// see TimeoutSnippetStore.
+type TimeoutTokenStore struct {
+	Store   TokenStore
+	Timeout time.Duration
+}
+
+func (t *TimeoutTokenStore) Insert(ctx context.Context, name string, scope TokenScope) (int, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Insert(ctx, name, scope)
+}
+
+func (t *TimeoutTokenStore) Authenticate(ctx context.Context, token string) (*APIToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Authenticate(ctx, token)
+}
+
+func (t *TimeoutTokenStore) List(ctx context.Context) ([]*APIToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.List(ctx)
+}
+
+func (t *TimeoutTokenStore) Revoke(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+	return t.Store.Revoke(ctx, id)
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// TokenScope is what an API token may be used for.
+type TokenScope string
+
+const (
+	ScopeRead  TokenScope = "read"
+	ScopeWrite TokenScope = "write"
+)
+
+// ParseTokenScope returns the TokenScope named by value. ok is false if value
+// isn't a known scope.
+func ParseTokenScope(value string) (TokenScope, bool) {
+	switch TokenScope(value) {
+	case ScopeRead, ScopeWrite:
+		return TokenScope(value), true
+	}
+	return "", false
+}
+
+// Allows reports whether a token with this scope may be used where the given
+// scope is required. The write scope includes read access.
+func (s TokenScope) Allows(required TokenScope) bool {
+	return s == required || s == ScopeWrite
+}
+
+// apiTokenPrefix starts every API token, which makes tokens easy to recognise
+// (by people and secret scanners alike) when they leak into logs or commits.
+const apiTokenPrefix = "snip_"
+
+// APIToken holds the data of a personal API token. The token itself is only
+// stored as a hash and can't be recovered. LastUsed is the zero time until the
+// token is used for the first time.
+type APIToken struct {
+	ID       int
+	Name     string
+	Scope    TokenScope
+	Created  time.Time
+	LastUsed time.Time
+}
+
+// TokenStore describes the API token operations used by the web application
+// and the `token` admin command.
+type TokenStore interface {
+	Insert(ctx context.Context, name string, scope TokenScope) (int, string, error)
+	Authenticate(ctx context.Context, token string) (*APIToken, error)
+	List(ctx context.Context) ([]*APIToken, error)
+	Revoke(ctx context.Context, id int) error
+}
+
+// newAPIToken generates a random API token, returning the token to hand to the
+// operator and the hash of it to store.
+func newAPIToken() (string, string, error) {
+	key, _, err := newManageKey()
+	if err != nil {
+		return "", "", err
+	}
+	token := apiTokenPrefix + key
+	return token, hashManageKey(token), nil
+}
+
+// TokenModel type wraps a sql.DB connection pool and implements TokenStore on top of MySQL.
+type TokenModel struct {
+	DB *sql.DB
+}
+
+// Insert mints a new token with the given name and scope. It returns the ID of
+// the token and the token itself, which is never available again.
+func (m *TokenModel) Insert(ctx context.Context, name string, scope TokenScope) (int, string, error) {
+	token, tokenHash, err := newAPIToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	stmt := `INSERT INTO api_tokens (name, scope, token_hash, created)
+	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	result, err := m.DB.ExecContext(ctx, stmt, name, string(scope), tokenHash)
+	if err != nil {
+		return 0, "", err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, "", err
+	}
+	return int(id), token, nil
+}
+
+// Authenticate returns the API token matching token and records that it has
+// been used. It returns ErrInvalidToken if there is no such token, for example
+// because it has been revoked.
+func (m *TokenModel) Authenticate(ctx context.Context, token string) (*APIToken, error) {
+	stmt := `SELECT id, name, scope, created, last_used FROM api_tokens WHERE token_hash = ?`
+	t, err := scanToken(m.DB.QueryRowContext(ctx, stmt, hashManageKey(token)))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `UPDATE api_tokens SET last_used = UTC_TIMESTAMP() WHERE id = ?`, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// List returns all API tokens, oldest first.
+func (m *TokenModel) List(ctx context.Context) ([]*APIToken, error) {
+	rows, err := m.DB.QueryContext(ctx, `SELECT id, name, scope, created, last_used FROM api_tokens ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTokens(rows)
+}
+
+// Revoke deletes the API token with the given ID, so it can't be used anymore.
+func (m *TokenModel) Revoke(ctx context.Context, id int) error {
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
+
+// tokenScanner is implemented by both *sql.Row and *sql.Rows.
+type tokenScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTokenRow reads an api_tokens row (id, name, scope, created, last_used).
+func scanTokenRow(row tokenScanner) (*APIToken, error) {
+	t := &APIToken{}
+	var lastUsed sql.NullTime
+	err := row.Scan(&t.ID, &t.Name, &t.Scope, &t.Created, &lastUsed)
+	if err != nil {
+		return nil, err
+	}
+	t.LastUsed = lastUsed.Time
+	return t, nil
+}
+
+// scanToken reads the single row of a token lookup, returning ErrInvalidToken
+// when there is none.
+func scanToken(row *sql.Row) (*APIToken, error) {
+	t, err := scanTokenRow(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// scanTokens reads every row of a token listing and closes rows.
+func scanTokens(rows *sql.Rows) ([]*APIToken, error) {
+	defer rows.Close()
+
+	var tokens []*APIToken
+	for rows.Next() {
+		t, err := scanTokenRow(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryTokenModel is an in-memory implementation of TokenStore. Tokens only
+// live as long as the process, so they can't be minted by the `token` admin
+// command and are mostly useful in tests.
+type MemoryTokenModel struct {
+	mu     sync.RWMutex
+	nextID int
+	tokens map[int]*APIToken
+	// hashes maps each token hash to the ID of its token
+	hashes map[string]int
+}
+
+// NewMemoryTokenModel returns an empty, ready to use MemoryTokenModel.
+func NewMemoryTokenModel() *MemoryTokenModel {
+	return &MemoryTokenModel{
+		nextID: 1,
+		tokens: make(map[int]*APIToken),
+		hashes: make(map[string]int),
+	}
+}
+
+// Insert mints a new token, see TokenModel.Insert.
+func (m *MemoryTokenModel) Insert(ctx context.Context, name string, scope TokenScope) (int, string, error) {
+	token, tokenHash, err := newAPIToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextID
+	m.nextID++
+	m.tokens[id] = &APIToken{
+		ID:      id,
+		Name:    name,
+		Scope:   scope,
+		Created: time.Now().UTC(),
+	}
+	m.hashes[tokenHash] = id
+	return id, token, nil
+}
+
+// Authenticate looks up a token and records its use, see TokenModel.Authenticate.
+func (m *MemoryTokenModel) Authenticate(ctx context.Context, token string) (*APIToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.hashes[hashManageKey(token)]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	t := m.tokens[id]
+	// return the token as it was before this use, like the SQL models do
+	found := *t
+	t.LastUsed = time.Now().UTC()
+	return &found, nil
+}
+
+// List returns all API tokens, oldest first.
+func (m *MemoryTokenModel) List(ctx context.Context) ([]*APIToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens := make([]*APIToken, 0, len(m.tokens))
+	for _, t := range m.tokens {
+		token := *t
+		tokens = append(tokens, &token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+	return tokens, nil
+}
+
+// Revoke deletes the API token with the given ID.
+func (m *MemoryTokenModel) Revoke(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.tokens[id]; !ok {
+		return ErrNoRecord
+	}
+	delete(m.tokens, id)
+	for hash, tokenID := range m.hashes {
+		if tokenID == id {
+			delete(m.hashes, hash)
+		}
+	}
+	return nil
+}
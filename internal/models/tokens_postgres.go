@@ -0,0 +1,63 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// PostgresTokenModel implements TokenStore on top of PostgreSQL.
+type PostgresTokenModel struct {
+	DB *sql.DB
+}
+
+// Insert mints a new token, see TokenModel.Insert.
+func (m *PostgresTokenModel) Insert(ctx context.Context, name string, scope TokenScope) (int, string, error) {
+	token, tokenHash, err := newAPIToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	stmt := `INSERT INTO api_tokens (name, scope, token_hash, created)
+	VALUES($1, $2, $3, NOW())
+	RETURNING id`
+
+	var id int
+	err = m.DB.QueryRowContext(ctx, stmt, name, string(scope), tokenHash).Scan(&id)
+	if err != nil {
+		return 0, "", err
+	}
+	return id, token, nil
+}
+
+// Authenticate looks up a token and records its use, see TokenModel.Authenticate.
+func (m *PostgresTokenModel) Authenticate(ctx context.Context, token string) (*APIToken, error) {
+	stmt := `SELECT id, name, scope, created, last_used FROM api_tokens WHERE token_hash = $1`
+	t, err := scanToken(m.DB.QueryRowContext(ctx, stmt, hashManageKey(token)))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `UPDATE api_tokens SET last_used = NOW() WHERE id = $1`, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// List returns all API tokens, oldest first.
+func (m *PostgresTokenModel) List(ctx context.Context) ([]*APIToken, error) {
+	rows, err := m.DB.QueryContext(ctx, `SELECT id, name, scope, created, last_used FROM api_tokens ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTokens(rows)
+}
+
+// Revoke deletes the API token with the given ID.
+func (m *PostgresTokenModel) Revoke(ctx context.Context, id int) error {
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
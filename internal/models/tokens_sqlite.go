@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// SQLiteTokenModel implements TokenStore on top of SQLite.
+type SQLiteTokenModel struct {
+	DB *sql.DB
+}
+
+// Insert mints a new token, see TokenModel.Insert.
+func (m *SQLiteTokenModel) Insert(ctx context.Context, name string, scope TokenScope) (int, string, error) {
+	token, tokenHash, err := newAPIToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	stmt := `INSERT INTO api_tokens (name, scope, token_hash, created)
+	VALUES(?, ?, ?, datetime('now'))`
+
+	result, err := m.DB.ExecContext(ctx, stmt, name, string(scope), tokenHash)
+	if err != nil {
+		return 0, "", err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, "", err
+	}
+	return int(id), token, nil
+}
+
+// Authenticate looks up a token and records its use, see TokenModel.Authenticate.
+func (m *SQLiteTokenModel) Authenticate(ctx context.Context, token string) (*APIToken, error) {
+	stmt := `SELECT id, name, scope, created, last_used FROM api_tokens WHERE token_hash = ?`
+	t, err := scanToken(m.DB.QueryRowContext(ctx, stmt, hashManageKey(token)))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.DB.ExecContext(ctx, `UPDATE api_tokens SET last_used = datetime('now') WHERE id = ?`, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// List returns all API tokens, oldest first.
+func (m *SQLiteTokenModel) List(ctx context.Context) ([]*APIToken, error) {
+	rows, err := m.DB.QueryContext(ctx, `SELECT id, name, scope, created, last_used FROM api_tokens ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanTokens(rows)
+}
+
+// Revoke deletes the API token with the given ID.
+func (m *SQLiteTokenModel) Revoke(ctx context.Context, id int) error {
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM api_tokens WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return checkAffected(result)
+}
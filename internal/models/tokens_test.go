@@ -0,0 +1,45 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTokenStoreRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		ctx := context.Background()
+		tokens := stores.Tokens
+
+		id, token, err := tokens.Insert(ctx, "ci", ScopeWrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		apiToken, err := tokens.Authenticate(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if apiToken.ID != id || apiToken.Name != "ci" || apiToken.Scope != ScopeWrite {
+			t.Errorf("got token %+v; want the inserted one", apiToken)
+		}
+
+		list, err := tokens.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].LastUsed.IsZero() {
+			t.Errorf("got tokens %+v; want the inserted one, used", list)
+		}
+
+		if err := tokens.Revoke(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tokens.Authenticate(ctx, token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("got error %v with a revoked token; want ErrInvalidToken", err)
+		}
+		if err := tokens.Revoke(ctx, id); !errors.Is(err, ErrNoRecord) {
+			t.Errorf("got error %v revoking twice; want ErrNoRecord", err)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of the model layer with the global tracer provider.
+var tracer = otel.Tracer("fcc-project/internal/models")
+
+// TracedSnippetStore wraps a SnippetStore, recording an OpenTelemetry span for
+// every call, as a child of the span in the context it is called with.
+type TracedSnippetStore struct {
+	Store SnippetStore
+	// System names the database behind Store, like "mysql", for the db.system
+	// attribute of the spans.
+	System string
+}
+
+// start starts the span of a call of operation.
+func (t *TracedSnippetStore) start(ctx context.Context, operation string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "SnippetStore."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", t.System),
+			attribute.String("db.operation", operation),
+		),
+	)
+}
+
+// endSpan ends span, recording err unless it merely reports that there was
+// nothing to find or that the request was invalid.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNoRecord) && !errors.Is(err, ErrInvalidCursor) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (t *TracedSnippetStore) Get(ctx context.Context, id int) (*Snippet, error) {
+	ctx, span := t.start(ctx, "Get")
+	s, err := t.Store.Get(ctx, id)
+	endSpan(span, err)
+	return s, err
+}
+
+func (t *TracedSnippetStore) GetBySlug(ctx context.Context, slug string) (*Snippet, error) {
+	ctx, span := t.start(ctx, "GetBySlug")
+	s, err := t.Store.GetBySlug(ctx, slug)
+	endSpan(span, err)
+	return s, err
+}
+
+func (t *TracedSnippetStore) Insert(ctx context.Context, title string, content string, expires int, visibility Visibility, burnAfterReading bool, password string, encrypted bool) (int, string, error) {
+	ctx, span := t.start(ctx, "Insert")
+	id, key, err := t.Store.Insert(ctx, title, content, expires, visibility, burnAfterReading, password, encrypted)
+	endSpan(span, err)
+	return id, key, err
+}
+
+func (t *TracedSnippetStore) Burn(ctx context.Context, slug string) (*Snippet, error) {
+	ctx, span := t.start(ctx, "Burn")
+	s, err := t.Store.Burn(ctx, slug)
+	endSpan(span, err)
+	return s, err
+}
+
+func (t *TracedSnippetStore) Latest(ctx context.Context) ([]*Snippet, error) {
+	ctx, span := t.start(ctx, "Latest")
+	snippets, err := t.Store.Latest(ctx)
+	endSpan(span, err)
+	return snippets, err
+}
+
+func (t *TracedSnippetStore) List(ctx context.Context, sort SnippetSort, cursor string, limit int) (*SnippetPage, error) {
+	ctx, span := t.start(ctx, "List")
+	page, err := t.Store.List(ctx, sort, cursor, limit)
+	endSpan(span, err)
+	return page, err
+}
+
+func (t *TracedSnippetStore) Search(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	ctx, span := t.start(ctx, "Search")
+	results, err := t.Store.Search(ctx, query, limit)
+	span.SetAttributes(attribute.Int("snippetbox.search.results", len(results)))
+	endSpan(span, err)
+	return results, err
+}
+
+func (t *TracedSnippetStore) CheckManageKey(ctx context.Context, id int, key string) (bool, error) {
+	ctx, span := t.start(ctx, "CheckManageKey")
+	ok, err := t.Store.CheckManageKey(ctx, id, key)
+	endSpan(span, err)
+	return ok, err
+}
+
+func (t *TracedSnippetStore) Update(ctx context.Context, id int, title string, content string) error {
+	ctx, span := t.start(ctx, "Update")
+	err := t.Store.Update(ctx, id, title, content)
+	endSpan(span, err)
+	return err
+}
+
+func (t *TracedSnippetStore) Delete(ctx context.Context, id int) error {
+	ctx, span := t.start(ctx, "Delete")
+	err := t.Store.Delete(ctx, id)
+	endSpan(span, err)
+	return err
+}
+
+func (t *TracedSnippetStore) Revisions(ctx context.Context, id int) ([]*Revision, error) {
+	ctx, span := t.start(ctx, "Revisions")
+	revisions, err := t.Store.Revisions(ctx, id)
+	endSpan(span, err)
+	return revisions, err
+}
+
+func (t *TracedSnippetStore) GetRevision(ctx context.Context, id int, revisionID int) (*Revision, error) {
+	ctx, span := t.start(ctx, "GetRevision")
+	r, err := t.Store.GetRevision(ctx, id, revisionID)
+	endSpan(span, err)
+	return r, err
+}
+
+func (t *TracedSnippetStore) PurgeExpired(ctx context.Context, before time.Time, batchSize int) (int, error) {
+	ctx, span := t.start(ctx, "PurgeExpired")
+	n, err := t.Store.PurgeExpired(ctx, before, batchSize)
+	endSpan(span, err)
+	return n, err
+}
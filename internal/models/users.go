@@ -0,0 +1,122 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User type holds the data for an individual user account. The password is
+// only ever stored as a bcrypt hash.
+type User struct {
+	ID             int
+	Name           string
+	Email          string
+	HashedPassword []byte
+	Created        time.Time
+}
+
+// UserStore describes the user account operations the web application relies on.
+type UserStore interface {
+	Insert(ctx context.Context, name string, email string, password string) error
+	Authenticate(ctx context.Context, email string, password string) (int, error)
+	Exists(ctx context.Context, id int) (bool, error)
+	Get(ctx context.Context, id int) (*User, error)
+}
+
+// bcryptCost is the bcrypt work factor used when hashing passwords.
+const bcryptCost = 12
+
+// UserModel type wraps a sql.DB connection pool and implements UserStore on top of MySQL.
+type UserModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a new user with a bcrypt hash of the given plain-text password.
+// It returns ErrDuplicateEmail if the email address is already taken.
+func (m *UserModel) Insert(ctx context.Context, name string, email string, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO users (name, email, hashed_password, created)
+	VALUES(?, ?, ?, UTC_TIMESTAMP())`
+
+	_, err = m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword))
+	if err != nil {
+		// If this returns an error, we use the errors.As() function to check
+		// whether the error has the type *mysql.MySQLError, and whether it
+		// relates to our users_uc_email unique constraint.
+		var mySQLError *mysql.MySQLError
+		if errors.As(err, &mySQLError) {
+			if mySQLError.Number == 1062 && strings.Contains(mySQLError.Message, "users_uc_email") {
+				return ErrDuplicateEmail
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Authenticate checks whether a user with the given email address and
+// password exists, and returns their ID if so.
+func (m *UserModel) Authenticate(ctx context.Context, email string, password string) (int, error) {
+	var id int
+	var hashedPassword []byte
+
+	stmt := `SELECT id, hashed_password FROM users WHERE email = ?`
+	err := m.DB.QueryRowContext(ctx, stmt, email).Scan(&id, &hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+	return id, checkPassword(hashedPassword, password)
+}
+
+// Exists reports whether a user with the given ID exists.
+func (m *UserModel) Exists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	stmt := `SELECT EXISTS(SELECT true FROM users WHERE id = ?)`
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&exists)
+	return exists, err
+}
+
+// Get returns the user with the given ID.
+func (m *UserModel) Get(ctx context.Context, id int) (*User, error) {
+	stmt := `SELECT id, name, email, hashed_password, created FROM users WHERE id = ?`
+	return scanUser(m.DB.QueryRowContext(ctx, stmt, id))
+}
+
+// checkPassword compares a plain-text password with a bcrypt hash, returning
+// ErrInvalidCredentials if they don't match.
+func checkPassword(hashedPassword []byte, password string) error {
+	err := bcrypt.CompareHashAndPassword(hashedPassword, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return ErrInvalidCredentials
+		}
+		return err
+	}
+	return nil
+}
+
+// scanUser reads a single users row (id, name, email, hashed_password, created).
+func scanUser(row *sql.Row) (*User, error) {
+	u := &User{}
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.HashedPassword, &u.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MemoryUserModel is an in-memory implementation of UserStore, the companion
+// of MemorySnippetModel. Accounts are lost when the process exits.
+type MemoryUserModel struct {
+	mu     sync.RWMutex
+	nextID int
+	users  map[int]*User
+}
+
+// NewMemoryUserModel returns an empty, ready to use MemoryUserModel.
+func NewMemoryUserModel() *MemoryUserModel {
+	return &MemoryUserModel{
+		nextID: 1,
+		users:  make(map[int]*User),
+	}
+}
+
+// Insert adds a new user, see UserModel.Insert.
+func (m *MemoryUserModel) Insert(ctx context.Context, name string, email string, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.users {
+		if u.Email == email {
+			return ErrDuplicateEmail
+		}
+	}
+
+	id := m.nextID
+	m.nextID++
+	m.users[id] = &User{
+		ID:             id,
+		Name:           name,
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Created:        time.Now().UTC(),
+	}
+	return nil
+}
+
+// Authenticate checks an email address and password, see UserModel.Authenticate.
+func (m *MemoryUserModel) Authenticate(ctx context.Context, email string, password string) (int, error) {
+	m.mu.RLock()
+	var user *User
+	for _, u := range m.users {
+		if u.Email == email {
+			user = u
+			break
+		}
+	}
+	m.mu.RUnlock()
+
+	if user == nil {
+		return 0, ErrInvalidCredentials
+	}
+	return user.ID, checkPassword(user.HashedPassword, password)
+}
+
+// Exists reports whether a user with the given ID exists.
+func (m *MemoryUserModel) Exists(ctx context.Context, id int) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.users[id]
+	return ok, nil
+}
+
+// Get returns the user with the given ID.
+func (m *MemoryUserModel) Get(ctx context.Context, id int) (*User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNoRecord
+	}
+	user := *u
+	return &user, nil
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PostgresUserModel implements UserStore on top of PostgreSQL.
+type PostgresUserModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a new user, see UserModel.Insert.
+func (m *PostgresUserModel) Insert(ctx context.Context, name string, email string, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO users (name, email, hashed_password, created)
+	VALUES($1, $2, $3, NOW())`
+
+	_, err = m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword))
+	if err != nil {
+		// 23505 is PostgreSQL's unique_violation error code
+		var pgError *pgconn.PgError
+		if errors.As(err, &pgError) {
+			if pgError.Code == "23505" && pgError.ConstraintName == "users_uc_email" {
+				return ErrDuplicateEmail
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Authenticate checks an email address and password, see UserModel.Authenticate.
+func (m *PostgresUserModel) Authenticate(ctx context.Context, email string, password string) (int, error) {
+	var id int
+	var hashedPassword []byte
+
+	stmt := `SELECT id, hashed_password FROM users WHERE email = $1`
+	err := m.DB.QueryRowContext(ctx, stmt, email).Scan(&id, &hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+	return id, checkPassword(hashedPassword, password)
+}
+
+// Exists reports whether a user with the given ID exists.
+func (m *PostgresUserModel) Exists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	stmt := `SELECT EXISTS(SELECT true FROM users WHERE id = $1)`
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&exists)
+	return exists, err
+}
+
+// Get returns the user with the given ID.
+func (m *PostgresUserModel) Get(ctx context.Context, id int) (*User, error) {
+	stmt := `SELECT id, name, email, hashed_password, created FROM users WHERE id = $1`
+	return scanUser(m.DB.QueryRowContext(ctx, stmt, id))
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SQLiteUserModel implements UserStore on top of SQLite.
+type SQLiteUserModel struct {
+	DB *sql.DB
+}
+
+// Insert adds a new user, see UserModel.Insert.
+func (m *SQLiteUserModel) Insert(ctx context.Context, name string, email string, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO users (name, email, hashed_password, created)
+	VALUES(?, ?, ?, datetime('now'))`
+
+	_, err = m.DB.ExecContext(ctx, stmt, name, email, string(hashedPassword))
+	if err != nil {
+		// email is the only unique column besides the primary key
+		var sqliteError sqlite3.Error
+		if errors.As(err, &sqliteError) {
+			if sqliteError.ExtendedCode == sqlite3.ErrConstraintUnique {
+				return ErrDuplicateEmail
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// Authenticate checks an email address and password, see UserModel.Authenticate.
+func (m *SQLiteUserModel) Authenticate(ctx context.Context, email string, password string) (int, error) {
+	var id int
+	var hashedPassword []byte
+
+	stmt := `SELECT id, hashed_password FROM users WHERE email = ?`
+	err := m.DB.QueryRowContext(ctx, stmt, email).Scan(&id, &hashedPassword)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidCredentials
+		}
+		return 0, err
+	}
+	return id, checkPassword(hashedPassword, password)
+}
+
+// Exists reports whether a user with the given ID exists.
+func (m *SQLiteUserModel) Exists(ctx context.Context, id int) (bool, error) {
+	var exists bool
+	stmt := `SELECT EXISTS(SELECT true FROM users WHERE id = ?)`
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&exists)
+	return exists, err
+}
+
+// Get returns the user with the given ID.
+func (m *SQLiteUserModel) Get(ctx context.Context, id int) (*User, error) {
+	stmt := `SELECT id, name, email, hashed_password, created FROM users WHERE id = ?`
+	return scanUser(m.DB.QueryRowContext(ctx, stmt, id))
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUserStoreRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, stores testStores) {
+		ctx := context.Background()
+		users := stores.Users
+
+		if err := users.Insert(ctx, "Alice", "alice@example.com", "pa$$word"); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.Insert(ctx, "Alice again", "alice@example.com", "pa$$word"); !errors.Is(err, ErrDuplicateEmail) {
+			t.Errorf("got error %v signing up twice; want ErrDuplicateEmail", err)
+		}
+
+		id, err := users.Authenticate(ctx, "alice@example.com", "pa$$word")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := users.Authenticate(ctx, "alice@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("got error %v with a wrong password; want ErrInvalidCredentials", err)
+		}
+
+		user, err := users.Get(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Name != "Alice" || user.Email != "alice@example.com" {
+			t.Errorf("got user %+v; want Alice", user)
+		}
+		if exists, err := users.Exists(ctx, id+1); err != nil || exists {
+			t.Errorf("got %t, %v for an unknown user; want false", exists, err)
+		}
+	})
+}
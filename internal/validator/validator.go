@@ -1,18 +1,31 @@
 package validator
 
 import (
+	"regexp"
 	"strings"
 	"unicode/utf8"
 )
 
-// Define a new Validator type which contains a map of validation errors for our form fields.
+// EmailRX is a regular expression for sanity checking the format of an email
+// address (this is the pattern recommended by the W3C and Web Hypertext
+// Application Technology Working Group).
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+// Define a new Validator type which contains a map of validation errors for our
+// form fields, plus a slice of errors which aren't related to a specific field.
 type Validator struct {
-	FieldErrors map[string]string
+	NonFieldErrors []string
+	FieldErrors    map[string]string
 }
 
-// Valid() returns true if the FieldErrors map doesn't contain any entries.
+// Valid() returns true if there are no field errors and no non-field errors.
 func (validator *Validator) Valid() bool {
-	return len(validator.FieldErrors) == 0
+	return len(validator.FieldErrors) == 0 && len(validator.NonFieldErrors) == 0
+}
+
+// AddNonFieldError() adds an error message to the NonFieldErrors slice.
+func (validator *Validator) AddNonFieldError(message string) {
+	validator.NonFieldErrors = append(validator.NonFieldErrors, message)
 }
 
 // AddFieldError() adds an error message to the FieldErrors map (so long as no entry already exists for the given key).
@@ -44,6 +57,16 @@ func MaxChars(value string, n int) bool {
 	return utf8.RuneCountInString(value) <= n
 }
 
+// MinChars() returns true if a value contains at least n characters.
+func MinChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) >= n
+}
+
+// Matches() returns true if a value matches a provided compiled regular expression pattern.
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
+
 // PermittedInt() returns true if a value is in a list of permitted integers.
 func PermittedInt(value int, permittedValues ...int) bool {
 	for i := range permittedValues {
@@ -53,3 +76,13 @@ func PermittedInt(value int, permittedValues ...int) bool {
 	}
 	return false
 }
+
+// PermittedValue() returns true if a value is in a list of permitted values.
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	for i := range permittedValues {
+		if value == permittedValues[i] {
+			return true
+		}
+	}
+	return false
+}
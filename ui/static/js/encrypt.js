@@ -0,0 +1,122 @@
+// End-to-end encryption of snippets. The content of an encrypted snippet is
+// encrypted here, in the browser, with AES-GCM under a random key. The key is
+// only ever kept in the fragment of the snippet link (the part after the #),
+// which browsers don't send to the server, so the server only sees ciphertext.
+//
+// The ciphertext is stored as the base64 encoding of the 12 byte nonce
+// followed by the encrypted content and the authentication tag.
+
+var NONCE_BYTES = 12;
+
+function toBase64(bytes) {
+	var binary = "";
+	for (var i = 0; i < bytes.length; i++) {
+		binary += String.fromCharCode(bytes[i]);
+	}
+	return btoa(binary);
+}
+
+function fromBase64(text) {
+	var binary = atob(text);
+	var bytes = new Uint8Array(binary.length);
+	for (var i = 0; i < binary.length; i++) {
+		bytes[i] = binary.charCodeAt(i);
+	}
+	return bytes;
+}
+
+// The key goes into links, so it uses the URL safe base64 alphabet without padding.
+function toBase64URL(bytes) {
+	return toBase64(bytes).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function fromBase64URL(text) {
+	text = text.replace(/-/g, "+").replace(/_/g, "/");
+	while (text.length % 4 !== 0) {
+		text += "=";
+	}
+	return fromBase64(text);
+}
+
+// encryptContent encrypts text under a new key, resolving to the ciphertext
+// and the key to put into the link.
+function encryptContent(text) {
+	var nonce = crypto.getRandomValues(new Uint8Array(NONCE_BYTES));
+	var key;
+	return crypto.subtle.generateKey({name: "AES-GCM", length: 256}, true, ["encrypt"]).then(function (generated) {
+		key = generated;
+		return crypto.subtle.encrypt({name: "AES-GCM", iv: nonce}, key, new TextEncoder().encode(text));
+	}).then(function (encrypted) {
+		var sealed = new Uint8Array(NONCE_BYTES + encrypted.byteLength);
+		sealed.set(nonce);
+		sealed.set(new Uint8Array(encrypted), NONCE_BYTES);
+		return crypto.subtle.exportKey("raw", key).then(function (raw) {
+			return {ciphertext: toBase64(sealed), key: toBase64URL(new Uint8Array(raw))};
+		});
+	});
+}
+
+// decryptContent decrypts ciphertext produced by encryptContent.
+function decryptContent(ciphertext, encodedKey) {
+	var sealed = fromBase64(ciphertext);
+	return crypto.subtle.importKey("raw", fromBase64URL(encodedKey), "AES-GCM", false, ["decrypt"]).then(function (key) {
+		return crypto.subtle.decrypt({name: "AES-GCM", iv: sealed.slice(0, NONCE_BYTES)}, key, sealed.slice(NONCE_BYTES));
+	}).then(function (decrypted) {
+		return new TextDecoder().decode(decrypted);
+	});
+}
+
+// The create form encrypts the content before posting it when the "encrypt in
+// browser" box is ticked. The key is added to the fragment of the form action:
+// browsers carry the fragment over to the page the server redirects to, which
+// is the link of the new snippet.
+var encryptForms = document.querySelectorAll("form[data-encrypt]");
+for (var i = 0; i < encryptForms.length; i++) {
+	encryptForms[i].addEventListener("submit", function (event) {
+		var form = event.target;
+		var content = form.querySelector("textarea[name=content]");
+		if (!form.querySelector("input[name=encrypted]").checked || content.value.trim() === "") {
+			return;
+		}
+
+		event.preventDefault();
+		encryptContent(content.value).then(function (encrypted) {
+			content.value = encrypted.ciphertext;
+			content.readOnly = true;
+			form.action = form.action.split("#")[0] + "#" + encrypted.key;
+			form.submit();
+		}, function (error) {
+			alert("The snippet could not be encrypted: " + error);
+		});
+	});
+}
+
+// Encrypted content is decrypted in place with the key in the fragment.
+var encryptedContents = document.querySelectorAll("[data-encrypted]");
+for (var i = 0; i < encryptedContents.length; i++) {
+	(function (element) {
+		var key = window.location.hash.slice(1);
+		if (key === "") {
+			element.textContent = "This snippet is encrypted, but the link has no key to decrypt it with.";
+			return;
+		}
+		decryptContent(element.textContent.trim(), key).then(function (text) {
+			element.textContent = text;
+		}, function () {
+			element.textContent = "This snippet could not be decrypted with the key in the link.";
+		});
+	})(encryptedContents[i]);
+}
+
+// Forms and links leading to an encrypted snippet keep the key in the fragment.
+var keepFragmentForms = document.querySelectorAll("form[data-keep-fragment]");
+for (var i = 0; i < keepFragmentForms.length; i++) {
+	keepFragmentForms[i].addEventListener("submit", function (event) {
+		event.target.action = event.target.action.split("#")[0] + window.location.hash;
+	});
+}
+var keepFragmentLinks = document.querySelectorAll("a[data-keep-fragment]");
+for (var i = 0; i < keepFragmentLinks.length; i++) {
+	keepFragmentLinks[i].href = keepFragmentLinks[i].href.split("#")[0] + window.location.hash;
+	keepFragmentLinks[i].textContent = keepFragmentLinks[i].textContent + window.location.hash;
+}
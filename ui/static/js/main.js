@@ -5,4 +5,15 @@ for (var i = 0; i < navLinks.length; i++) {
 		link.classList.add("live");
 		break;
 	}
-}
\ No newline at end of file
+}
+
+// The management link of a snippet holds its key in the fragment, which never
+// reaches the server. The manage form posts the key from there, after dropping
+// it from the address bar and the history.
+var keyForms = document.querySelectorAll("form[data-key-from-fragment]");
+if (keyForms.length > 0 && window.location.hash.length > 1) {
+	var key = window.location.hash.slice(1);
+	history.replaceState(null, "", window.location.pathname + window.location.search);
+	keyForms[0].querySelector("input[name=key]").value = key;
+	keyForms[0].submit();
+}